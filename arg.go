@@ -2,17 +2,25 @@ package conf
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
 )
 
-var ErrInvalidValue = errors.New("invalid value")
+var (
+	ErrInvalidValue    = errors.New("invalid value")
+	ErrValueOutOfRange = errors.New("value out of range")
+)
 
 type Bool struct {
 	rValue *reflect.Value
 	DefValue
 	Description
 	Has
+	Secret
+	Origin
+	Constraint
 }
 
 func NewBool(r *reflect.Value) *Bool {
@@ -27,28 +35,50 @@ func (b *Bool) GetValue() interface{} {
 func (b *Bool) SetValue(str interface{}) error {
 	switch v := str.(type) {
 	case string:
-		if str == "true" {
-			b.rValue.SetBool(true)
-			return nil
-		} else if str == "false" {
-			b.rValue.SetBool(false)
-			return nil
-		} else {
-			return ErrInvalidValue
+		vv, err := parseBool(v)
+		if err != nil {
+			return err
 		}
+		b.rValue.SetBool(vv)
+		return nil
 	case bool:
 		b.rValue.SetBool(v)
 		return nil
+	case int:
+		// yaml 中的 0 和 1
+		if v != 0 && v != 1 {
+			return ErrInvalidValue
+		}
+		b.rValue.SetBool(v == 1)
+		return nil
 	default:
 		return ErrInvalidValue
 	}
 }
 
+// parseBool 支持 strconv.ParseBool 的格式以及 yes/no, on/off, y/n, 不区分大小写
+func parseBool(str string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(str)) {
+	case "yes", "y", "on":
+		return true, nil
+	case "no", "n", "off":
+		return false, nil
+	}
+	v, err := strconv.ParseBool(strings.ToLower(strings.TrimSpace(str)))
+	if err != nil {
+		return false, ErrInvalidValue
+	}
+	return v, nil
+}
+
 type Int struct {
 	rValue *reflect.Value
 	DefValue
 	Description
 	Has
+	Secret
+	Origin
+	Constraint
 }
 
 func NewInt(r *reflect.Value) *Int {
@@ -61,26 +91,14 @@ func (i *Int) GetValue() interface{} {
 }
 
 func (i *Int) SetValue(str interface{}) error {
-	switch v := str.(type) {
-	case string:
-		vv, err := strconv.Atoi(v)
-		if err != nil {
-			return err
-		}
-		i.rValue.SetInt(int64(vv))
-	case int:
-		i.rValue.SetInt(int64(v))
-	case int64:
-		i.rValue.SetInt(v)
-	case int32:
-		i.rValue.SetInt(int64(v))
-	case int16:
-		i.rValue.SetInt(int64(v))
-	case int8:
-		i.rValue.SetInt(int64(v))
-	default:
-		return ErrInvalidValue
+	n, err := toInt64(str)
+	if err != nil {
+		return err
 	}
+	if i.rValue.OverflowInt(n) {
+		return errOutOfRange(str, i.rValue.Type())
+	}
+	i.rValue.SetInt(n)
 	return nil
 }
 
@@ -89,6 +107,9 @@ type Uint struct {
 	DefValue
 	Description
 	Has
+	Secret
+	Origin
+	Constraint
 }
 
 func NewUint(r *reflect.Value) *Uint {
@@ -101,26 +122,14 @@ func (u *Uint) GetValue() interface{} {
 }
 
 func (u *Uint) SetValue(str interface{}) error {
-	switch v := str.(type) {
-	case string:
-		vv, err := strconv.Atoi(v)
-		if err != nil {
-			return err
-		}
-		u.rValue.SetUint(uint64(vv))
-	case uint:
-		u.rValue.SetUint(uint64(v))
-	case uint64:
-		u.rValue.SetUint(v)
-	case uint32:
-		u.rValue.SetUint(uint64(v))
-	case uint16:
-		u.rValue.SetUint(uint64(v))
-	case uint8:
-		u.rValue.SetUint(uint64(v))
-	default:
-		return ErrInvalidValue
+	n, err := toUint64(str)
+	if err != nil {
+		return err
+	}
+	if u.rValue.OverflowUint(n) {
+		return errOutOfRange(str, u.rValue.Type())
 	}
+	u.rValue.SetUint(n)
 	return nil
 }
 
@@ -129,6 +138,9 @@ type String struct {
 	DefValue
 	Description
 	Has
+	Secret
+	Origin
+	Constraint
 }
 
 func NewString(r *reflect.Value) *String {
@@ -155,6 +167,9 @@ type Float struct {
 	DefValue
 	Description
 	Has
+	Secret
+	Origin
+	Constraint
 }
 
 func NewFloat(r *reflect.Value) *Float {
@@ -167,20 +182,14 @@ func (f *Float) GetValue() interface{} {
 }
 
 func (f *Float) SetValue(str interface{}) error {
-	switch v := str.(type) {
-	case string:
-		vv, err := strconv.ParseFloat(v, 64)
-		if err != nil {
-			return err
-		}
-		f.rValue.SetFloat(vv)
-	case float64:
-		f.rValue.SetFloat(v)
-	case float32:
-		f.rValue.SetFloat(float64(v))
-	default:
-		return ErrInvalidValue
+	n, err := toFloat64(str)
+	if err != nil {
+		return err
+	}
+	if f.rValue.OverflowFloat(n) {
+		return errOutOfRange(str, f.rValue.Type())
 	}
+	f.rValue.SetFloat(n)
 	return nil
 }
 
@@ -189,6 +198,9 @@ type Interface struct {
 	DefValue
 	Description
 	Has
+	Secret
+	Origin
+	Constraint
 }
 
 func NewInterface(r interface{}) *Interface {
@@ -205,6 +217,139 @@ func (i *Interface) SetValue(str interface{}) error {
 	return nil
 }
 
+type Slice struct {
+	rValue *reflect.Value
+	DefValue
+	Description
+	Has
+	Secret
+	Origin
+	Constraint
+}
+
+func NewSlice(r *reflect.Value) *Slice {
+	ret := &Slice{rValue: r}
+	return ret
+}
+
+func (s *Slice) GetValue() interface{} {
+	return s.rValue.Interface()
+}
+
+// SetValue 字符串按逗号分隔, 也支持 []string 和 []interface{}
+// 每个元素按照元素类型的规则设置
+func (s *Slice) SetValue(str interface{}) error {
+	var items []interface{}
+	switch v := str.(type) {
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item == "" {
+				continue
+			}
+			items = append(items, item)
+		}
+	case []string:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	case []interface{}:
+		items = v
+	default:
+		if reflect.TypeOf(str) != s.rValue.Type() {
+			return ErrInvalidValue
+		}
+		s.rValue.Set(reflect.ValueOf(str))
+		return nil
+	}
+	ret := reflect.MakeSlice(s.rValue.Type(), len(items), len(items))
+	for i, item := range items {
+		elem := ret.Index(i)
+		err := newScalarArg(&elem).SetValue(item)
+		if err != nil {
+			return err
+		}
+	}
+	s.rValue.Set(ret)
+	return nil
+}
+
+// scratchArg 创建类型, 当前值和规则都相同的副本, 修改副本不影响参数
+func (x *X) scratchArg(arg Arg, strict bool) (Arg, error) {
+	var rValue *reflect.Value
+	switch a := arg.(type) {
+	case *Interface:
+		ret := NewInterface(a.value)
+		copyArgMeta(ret, arg)
+		return ret, nil
+	case *StructSlice:
+		mode := x.strict
+		if strict {
+			mode = StrictError
+		}
+		return a.scratch(mode), nil
+	case *Bool:
+		rValue = a.rValue
+	case *Int:
+		rValue = a.rValue
+	case *Uint:
+		rValue = a.rValue
+	case *String:
+		rValue = a.rValue
+	case *Float:
+		rValue = a.rValue
+	case *ByteSizeArg:
+		rValue = a.rValue
+	case *PercentArg:
+		rValue = a.rValue
+	case *Slice:
+		rValue = a.rValue
+	default:
+		return nil, errors.Join(ErrArgSetValue, errors.New(fmt.Sprintf("arg type %T not supported", arg)))
+	}
+	v := reflect.New(rValue.Type()).Elem()
+	v.Set(*rValue)
+	var ret Arg
+	if _, ok := arg.(*Slice); ok {
+		ret = NewSlice(&v)
+	} else {
+		ret = newScalarArg(&v)
+	}
+	copyArgMeta(ret, arg)
+	return ret, nil
+}
+
+// copyArgMeta 复制参数的默认值, 描述, 敏感标记和校验规则
+func copyArgMeta(dst Arg, src Arg) {
+	dst.SetDefaultValue(src.GetDefaultValue())
+	dst.SetDescription(src.GetDescription())
+	setSecret(dst, isSecret(src))
+	setRule(dst, argRule(src))
+}
+
+// newScalarArg 根据类型创建标量参数, 不支持的类型返回 nil
+func newScalarArg(r *reflect.Value) Arg {
+	switch r.Type() {
+	case byteSizeType:
+		return NewByteSizeArg(r)
+	case percentType:
+		return NewPercentArg(r)
+	}
+	switch r.Kind() {
+	case reflect.String:
+		return NewString(r)
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Int16, reflect.Int8:
+		return NewInt(r)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uint16, reflect.Uint8:
+		return NewUint(r)
+	case reflect.Float64, reflect.Float32:
+		return NewFloat(r)
+	case reflect.Bool:
+		return NewBool(r)
+	default:
+		return nil
+	}
+}
+
 type Has struct {
 	hasSet bool
 }
@@ -217,6 +362,11 @@ func (h *Has) Set() {
 	h.hasSet = true
 }
 
+// unset 清除已设置的标志, Reload 时使用
+func (h *Has) unset() {
+	h.hasSet = false
+}
+
 type DefValue struct {
 	defValue string
 }
@@ -240,3 +390,94 @@ func (d *Description) GetDescription() string {
 func (d *Description) SetDescription(desc string) {
 	d.desc = desc
 }
+
+type Secret struct {
+	secret bool
+}
+
+func (s *Secret) IsSecret() bool {
+	return s.secret
+}
+
+func (s *Secret) SetSecret(secret bool) {
+	s.secret = secret
+}
+
+// Origin 记录参数的值来自哪里, 例如 default, flag, yaml (config.yaml:3), set
+type Origin struct {
+	origin string
+}
+
+func (o *Origin) GetOrigin() string {
+	return o.origin
+}
+
+func (o *Origin) SetOrigin(origin string) {
+	o.origin = origin
+}
+
+// Rule 参数的校验规则, 通过标签中的 required, enum, min, max 设置
+// min 和 max 对数值限制大小, 对字符串和切片限制长度
+type Rule struct {
+	Required bool
+	Enum     []string
+	Min      *float64
+	Max      *float64
+	// 通过标签中的 deprecated 设置, 配置源设置该参数时输出警告, 例如 deprecated=use t_host
+	Deprecated        bool
+	DeprecatedMessage string
+}
+
+type Constraint struct {
+	rule Rule
+}
+
+func (c *Constraint) GetRule() Rule {
+	return c.rule
+}
+
+func (c *Constraint) SetRule(rule Rule) {
+	c.rule = rule
+}
+
+// isSecret 参数没有实现 SecretArg 时不隐藏
+func isSecret(arg Arg) bool {
+	if s, ok := arg.(SecretArg); ok {
+		return s.IsSecret()
+	}
+	return false
+}
+
+func setSecret(arg Arg, secret bool) {
+	if s, ok := arg.(SecretArg); ok {
+		s.SetSecret(secret)
+	}
+}
+
+// argOrigin 参数没有实现 OriginArg 时返回空
+func argOrigin(arg Arg) string {
+	if o, ok := arg.(OriginArg); ok {
+		return o.GetOrigin()
+	}
+	return ""
+}
+
+func setOrigin(arg Arg, origin string) {
+	if o, ok := arg.(OriginArg); ok {
+		o.SetOrigin(origin)
+	}
+}
+
+// argRule 参数没有实现 RuleArg 时没有校验规则
+func argRule(arg Arg) Rule {
+	if r, ok := arg.(RuleArg); ok {
+		return r.GetRule()
+	}
+	return Rule{}
+}
+
+func setRule(arg Arg, rule Rule) {
+	if r, ok := arg.(RuleArg); ok {
+		r.SetRule(rule)
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/innsanes/conf/cmd/conf
+
+go 1.21
+
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/innsanes/conf v0.0.0-00010101000000-000000000000
+	github.com/stretchr/testify v1.9.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+)
+
+replace github.com/innsanes/conf => ../..
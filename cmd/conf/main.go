@@ -0,0 +1,342 @@
+// conf 根据服务导出的 JSON Schema 检查配置文件, 不需要编译服务本身
+//
+//	conf validate -schema schema.json config.yaml
+//	conf explain -schema schema.json [-file config.yaml] t_port
+//	conf diff -schema schema.json a.yaml b.yaml
+//	conf fmt -schema schema.json [-w] config.yaml
+//
+// schema 由 X.JSONSchema 生成, 配置文件支持 yaml, json 和 toml, fmt 只支持 yaml
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/innsanes/conf"
+	"github.com/innsanes/conf/internal/yamlnode"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrFileFormat = errors.New("file format not support")
+
+const usage = `Usage:
+  conf validate -schema schema.json [-profile prod] config.yaml
+  conf explain -schema schema.json [-file config.yaml] key
+  conf diff -schema schema.json [-profile prod] a.yaml b.yaml
+  conf fmt -schema schema.json [-w] config.yaml
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run 执行子命令并返回退出码, 0 成功, 1 校验失败或存在差异, 2 参数或文件错误
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		_, _ = io.WriteString(stderr, usage)
+		return 2
+	}
+	var cmd func(args []string, stdout io.Writer, stderr io.Writer) int
+	switch args[0] {
+	case "validate":
+		cmd = validateCmd
+	case "explain":
+		cmd = explainCmd
+	case "diff":
+		cmd = diffCmd
+	case "fmt":
+		cmd = fmtCmd
+	case "-h", "-help", "--help", "help":
+		_, _ = io.WriteString(stdout, usage)
+		return 0
+	default:
+		_, _ = fmt.Fprintf(stderr, "unknown command %s\n%s", args[0], usage)
+		return 2
+	}
+	return cmd(args[1:], stdout, stderr)
+}
+
+type options struct {
+	flags   *flag.FlagSet
+	schema  string
+	profile string
+	file    string
+	write   bool
+}
+
+func newOptions(name string, stderr io.Writer) *options {
+	o := &options{flags: flag.NewFlagSet(name, flag.ContinueOnError)}
+	o.flags.SetOutput(stderr)
+	o.flags.StringVar(&o.schema, "schema", "", "json schema generated by X.JSONSchema")
+	o.flags.StringVar(&o.profile, "profile", "", "active profiles separated by comma")
+	return o
+}
+
+// parse 解析参数并加载 schema, 位置参数的数量必须为 n
+func (o *options) parse(args []string, n int, stderr io.Writer) (*schema, bool) {
+	if err := o.flags.Parse(args); err != nil {
+		return nil, false
+	}
+	if o.schema == "" || o.flags.NArg() != n {
+		_, _ = io.WriteString(stderr, usage)
+		return nil, false
+	}
+	s, err := loadSchema(o.schema)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return nil, false
+	}
+	return s, true
+}
+
+func validateCmd(args []string, stdout io.Writer, stderr io.Writer) int {
+	o := newOptions("validate", stderr)
+	s, ok := o.parse(args, 1, stderr)
+	if !ok {
+		return 2
+	}
+	file := o.flags.Arg(0)
+	l, err := loadConfig(s, file, o.profile, conf.StrictError)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+	for _, warning := range l.warnings {
+		_, _ = fmt.Fprintf(stdout, "warning: %s\n", warning)
+	}
+	if len(l.errs) > 0 {
+		for _, err := range l.errs {
+			_, _ = fmt.Fprintln(stdout, err)
+		}
+		return 1
+	}
+	_, _ = fmt.Fprintf(stdout, "%s: ok\n", file)
+	return 0
+}
+
+func explainCmd(args []string, stdout io.Writer, stderr io.Writer) int {
+	o := newOptions("explain", stderr)
+	o.flags.StringVar(&o.file, "file", "", "config file to show the resolved value")
+	s, ok := o.parse(args, 1, stderr)
+	if !ok {
+		return 2
+	}
+	key := o.flags.Arg(0)
+	schemaKey, prop := s.lookup(key)
+	if prop == nil {
+		_, _ = fmt.Fprintf(stderr, "unknown key %s\n", key)
+		return 2
+	}
+	lines := [][2]string{{"key", key}, {"type", typeString(prop)}}
+	for i := 0; i+1 < len(prop.Content); i += 2 {
+		name, value := prop.Content[i].Value, prop.Content[i+1]
+		switch name {
+		case "type", "description", "properties", "required":
+		case "items":
+			if enum := yamlnode.Value(value, "enum"); enum != nil {
+				lines = append(lines, [2]string{"enum", nodeString(enum)})
+			}
+		default:
+			lines = append(lines, [2]string{name, nodeString(value)})
+		}
+	}
+	lines = append(lines, [2]string{"required", strconv.FormatBool(s.required[schemaKey])})
+	if desc := scalarValue(prop, "description"); desc != "" {
+		lines = append(lines, [2]string{"description", desc})
+	}
+	if o.file != "" {
+		l, err := loadConfig(s, o.file, o.profile, conf.StrictOff)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return 2
+		}
+		for _, config := range l.configs {
+			if config.Key == key {
+				lines = append(lines, [2]string{"value", fmt.Sprint(config.Value)}, [2]string{"origin", config.Origin})
+			}
+		}
+	}
+	for _, line := range lines {
+		_, _ = fmt.Fprintf(stdout, "%-12s %s\n", line[0]+":", line[1])
+	}
+	return 0
+}
+
+func diffCmd(args []string, stdout io.Writer, stderr io.Writer) int {
+	o := newOptions("diff", stderr)
+	s, ok := o.parse(args, 2, stderr)
+	if !ok {
+		return 2
+	}
+	var loaded [2]*loadResult
+	for i := range loaded {
+		l, err := loadConfig(s, o.flags.Arg(i), o.profile, conf.StrictOff)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return 2
+		}
+		loaded[i] = l
+	}
+	diffs := conf.Diff(loaded[0].configs, loaded[1].configs)
+	_, _ = io.WriteString(stdout, conf.DiffText(diffs))
+	if len(diffs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func fmtCmd(args []string, stdout io.Writer, stderr io.Writer) int {
+	o := newOptions("fmt", stderr)
+	o.flags.BoolVar(&o.write, "w", false, "write result to the file instead of stdout")
+	s, ok := o.parse(args, 1, stderr)
+	if !ok {
+		return 2
+	}
+	file := o.flags.Arg(0)
+	if ext := strings.ToLower(filepath.Ext(file)); ext != ".yaml" && ext != ".yml" {
+		_, _ = fmt.Fprintln(stderr, errors.Join(ErrFileFormat, errors.New(fmt.Sprintf("fmt only supports yaml, file:%s", file))))
+		return 2
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+	var doc yaml.Node
+	err = yaml.Unmarshal(data, &doc)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if doc.Kind == 0 {
+		return 0
+	}
+	orderNode(doc.Content[0], s.root, true)
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	err = encoder.Encode(&doc)
+	if err == nil {
+		err = encoder.Close()
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if o.write {
+		err = os.WriteFile(file, buf.Bytes(), info.Mode().Perm())
+	} else {
+		_, err = stdout.Write(buf.Bytes())
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+	return 0
+}
+
+type loadResult struct {
+	configs  []conf.ConfigResult
+	errs     []error
+	warnings []string
+}
+
+// loadConfig 使用 schema 创建的结构体解析配置文件, 返回解析后的参数和所有错误
+// yaml 和 json 使用 Yaml 配置源, toml 使用 toml 解码器的 Yaml 配置源
+func loadConfig(s *schema, file string, profile string, strict conf.StrictMode) (*loadResult, error) {
+	ext := strings.ToLower(filepath.Ext(file))
+	switch ext {
+	case ".yaml", ".yml", ".json", ".toml":
+	default:
+		return nil, errors.Join(ErrFileFormat, errors.New(fmt.Sprintf("only yaml, json and toml are supported, file:%s", file)))
+	}
+	// 文件不存在时 Yaml 会生成模板, 这里需要提前检查
+	if _, err := os.Stat(file); err != nil {
+		return nil, err
+	}
+	l := &loadResult{}
+	x := conf.New(conf.WithStrict(strict), conf.WithResultHandler(func(result *conf.ParseResult) {
+		if result.Err != nil {
+			l.errs = append(l.errs, result.Err)
+		}
+		l.warnings = append(l.warnings, result.Warnings...)
+		if configs := result.Configs(); len(configs) > 0 {
+			l.configs = configs
+		}
+	}))
+	s.register(x)
+	y := conf.NewYaml(x)
+	if ext == ".toml" {
+		y = conf.NewYamlWithDecoder(x, "toml", decodeToml)
+	}
+	y.YamlConf.FilePath = file
+	y.YamlConf.Profile = profile
+	x.RegisterSource(y)
+	x.Parse()
+	x.PrintResult()
+	return l, nil
+}
+
+// orderNode 按照 schema 中属性的顺序排列 mapping 的键, 未知的键保持原来的顺序放在最后
+// 顶层的 profiles 下每个环境的配置按照顶层的顺序排列
+func orderNode(node *yaml.Node, prop *yaml.Node, root bool) {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			orderNode(item, yamlnode.Value(prop, "items"), false)
+		}
+	case yaml.MappingNode:
+		properties := yamlnode.Value(prop, "properties")
+		var ordered []*yaml.Node
+		used := make(map[int]bool)
+		if properties != nil {
+			for i := 0; i+1 < len(properties.Content); i += 2 {
+				for j := 0; j+1 < len(node.Content); j += 2 {
+					if !used[j] && node.Content[j].Value == properties.Content[i].Value {
+						ordered = append(ordered, node.Content[j], node.Content[j+1])
+						used[j] = true
+					}
+				}
+			}
+		}
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if !used[j] {
+				ordered = append(ordered, node.Content[j], node.Content[j+1])
+			}
+		}
+		node.Content = ordered
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			key, value := node.Content[j].Value, node.Content[j+1]
+			if root && key == "profiles" && value.Kind == yaml.MappingNode {
+				for k := 1; k < len(value.Content); k += 2 {
+					orderNode(value.Content[k], prop, false)
+				}
+				continue
+			}
+			orderNode(value, yamlnode.Value(properties, key), false)
+		}
+	}
+}
+
+// typeString 返回属性的类型, 数组包括元素的类型
+func typeString(prop *yaml.Node) string {
+	typ := nodeString(yamlnode.Value(prop, "type"))
+	if hasType(prop, "array") {
+		if items := yamlnode.Value(prop, "items"); items != nil {
+			typ += " of " + typeString(items)
+		}
+	}
+	return typ
+}
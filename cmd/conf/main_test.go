@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/innsanes/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+type testServer struct {
+	Name      string         `conf:"name,required=true,usage=service name"`
+	Mode      string         `conf:"mode,default=fast,enum=fast|safe"`
+	Port      int            `conf:"port,default=8080,min=1,max=65535,usage=listen port"`
+	Buffer    conf.ByteSize  `conf:"buffer,default=1MiB"`
+	Upstreams []testUpstream `conf:"upstreams"`
+}
+
+type testUpstream struct {
+	Host string `conf:"host,default=localhost"`
+	Port int    `conf:"port,default=80"`
+}
+
+func writeTestFile(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+// 测试 根据 schema 校验, 解释, 比较以及格式化配置文件
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	x := conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {}))
+	x.RegisterConfWithName("t", &testServer{})
+	x.Parse()
+	data, err := x.JSONSchema()
+	assert.Nil(t, err)
+	schemaFile := writeTestFile(t, dir, "schema.json", string(data))
+
+	good := writeTestFile(t, dir, "good.yaml", "t:\n  port: 80\n  name: app\n  buffer: 2MiB\n  upstreams:\n    - host: a\n")
+	bad := writeTestFile(t, dir, "bad.yaml", "t:\n  mode: slow\n  prot: 80\n")
+	json := writeTestFile(t, dir, "good.json", `{"t": {"name": "app", "port": 81}}`)
+	toml := writeTestFile(t, dir, "good.toml", "[t]\nname = \"app\"\nport = 81\n\n[[t.upstreams]]\nhost = \"a\"\n\n[profiles.prod.t]\nmode = \"safe\"\n")
+	writeTestFile(t, dir, "good.prod.toml", "[t]\nport = 82\n")
+	badToml := writeTestFile(t, dir, "bad.toml", "[t]\nprot = 80\nname = \n")
+	ini := writeTestFile(t, dir, "good.ini", "[t]\nname = app\n")
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	assert.Equal(t, 0, run([]string{"validate", "-schema", schemaFile, good}, stdout, stderr))
+	assert.Equal(t, good+": ok\n", stdout.String())
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"validate", "-schema", schemaFile, json}, stdout, stderr))
+	stdout.Reset()
+	assert.Equal(t, 1, run([]string{"validate", "-schema", schemaFile, bad}, stdout, stderr))
+	assert.Contains(t, stdout.String(), "unknown key t_prot")
+	assert.Contains(t, stdout.String(), "did you mean t_port?")
+	assert.Contains(t, stdout.String(), "t_name is required")
+	assert.Contains(t, stdout.String(), "t_mode value slow not in [fast safe]")
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"validate", "-schema", schemaFile, toml}, stdout, stderr))
+	stdout.Reset()
+	assert.Equal(t, 1, run([]string{"validate", "-schema", schemaFile, badToml}, stdout, stderr))
+	assert.Contains(t, stdout.String(), "toml load err")
+	assert.Equal(t, 2, run([]string{"validate", "-schema", schemaFile, ini}, stdout, stderr))
+	assert.Contains(t, stderr.String(), "only yaml, json and toml are supported")
+
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"explain", "-schema", schemaFile, "-file", good, "t_upstreams_0_port"}, stdout, stderr))
+	assert.Equal(t, "key:         t_upstreams_0_port\n"+
+		"type:        integer\n"+
+		"default:     80\n"+
+		"required:    false\n"+
+		"value:       80\n"+
+		"origin:      default\n", stdout.String())
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"explain", "-schema", schemaFile, "t_port"}, stdout, stderr))
+	assert.Equal(t, "key:         t_port\n"+
+		"type:        integer\n"+
+		"default:     8080\n"+
+		"minimum:     1\n"+
+		"maximum:     65535\n"+
+		"required:    false\n"+
+		"description: listen port\n", stdout.String())
+
+	stdout.Reset()
+	assert.Equal(t, 1, run([]string{"diff", "-schema", schemaFile, good, json}, stdout, stderr))
+	assert.Equal(t, "~ t_port: 80 -> 81 [yaml ("+good+":2) -> yaml ("+json+":1)]\n"+
+		"~ t_buffer: 2MiB -> 1MiB [yaml ("+good+":4) -> default]\n"+
+		"- t_upstreams_0_host: a [yaml ("+good+":6)]\n"+
+		"- t_upstreams_0_port: 80 [default]\n", stdout.String())
+	// toml 中 profiles 下的配置先于 config.prod.toml 合并
+	stdout.Reset()
+	assert.Equal(t, 1, run([]string{"diff", "-schema", schemaFile, "-profile", "prod", good, toml}, stdout, stderr))
+	assert.Equal(t, "~ t_mode: fast -> safe [default -> toml ("+toml+":9)]\n"+
+		"~ t_port: 80 -> 82 [yaml ("+good+":2) -> toml ("+filepath.Join(dir, "good.prod.toml")+":2)]\n"+
+		"~ t_buffer: 2MiB -> 1MiB [yaml ("+good+":4) -> default]\n", stdout.String())
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"explain", "-schema", schemaFile, "-file", toml, "t_upstreams_0_host"}, stdout, stderr))
+	assert.Contains(t, stdout.String(), "origin:      toml ("+toml+":6)\n")
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"diff", "-schema", schemaFile, good, good}, stdout, stderr))
+	assert.Equal(t, "", stdout.String())
+
+	stdout.Reset()
+	unordered := writeTestFile(t, dir, "unordered.yaml", "# server\nt:\n  extra: 1\n  port: 80 # port\n  name: app\n")
+	assert.Equal(t, 0, run([]string{"fmt", "-schema", schemaFile, "-w", unordered}, stdout, stderr))
+	content, err := os.ReadFile(unordered)
+	assert.Nil(t, err)
+	assert.Equal(t, "# server\nt:\n  name: app\n  port: 80 # port\n  extra: 1\n", string(content))
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/innsanes/conf"
+	"github.com/innsanes/conf/internal/yamlnode"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrSchema = errors.New("schema err")
+
+// 结构体切片元素下标的占位符, 与 WriteDocs 保持一致, 例如 t_upstreams_<i>_host
+const indexPlaceholder = "<i>"
+
+var indexPattern = regexp.MustCompile(`_\d+(_|$)`)
+
+// schema 由 X.JSONSchema 生成的文档, 每个顶层属性对应一个注册的结构体
+// 结构体的类型通过 reflect.StructOf 动态创建, 解析和校验复用 conf 的参数
+type schema struct {
+	root  *yaml.Node
+	names []string
+	types []reflect.Type
+	// 完整的键对应的属性, 结构体切片的元素使用 <i> 作为下标
+	props    map[string]*yaml.Node
+	required map[string]bool
+}
+
+func loadSchema(file string) (*schema, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Join(ErrSchema, err)
+	}
+	// json 是 yaml 的子集, 使用 yaml.Node 解析可以保持属性的顺序
+	var doc yaml.Node
+	err = yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, errors.Join(ErrSchema, err)
+	}
+	if doc.Kind == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.Join(ErrSchema, errors.New(fmt.Sprintf("%s is not a json schema object", file)))
+	}
+	s := &schema{
+		root:     doc.Content[0],
+		props:    make(map[string]*yaml.Node),
+		required: make(map[string]bool),
+	}
+	properties := yamlnode.Value(s.root, "properties")
+	if properties == nil {
+		return s, nil
+	}
+	for i := 0; i+1 < len(properties.Content); i += 2 {
+		name, prop := properties.Content[i].Value, properties.Content[i+1]
+		if !hasType(prop, "object") {
+			return nil, errors.Join(ErrSchema, errors.New(fmt.Sprintf("top level property %s is not an object", name)))
+		}
+		typ, err := s.structType(prop, name)
+		if err != nil {
+			return nil, errors.Join(ErrSchema, err)
+		}
+		s.names = append(s.names, name)
+		s.types = append(s.types, typ)
+	}
+	return s, nil
+}
+
+// register 为每个顶层属性创建结构体并注册到 x
+func (s *schema) register(x *conf.X) {
+	for i, name := range s.names {
+		x.RegisterConfWithName(name, reflect.New(s.types[i]).Interface())
+	}
+}
+
+// lookup 返回键对应的属性, 结构体切片的下标会被替换为 <i>
+func (s *schema) lookup(key string) (string, *yaml.Node) {
+	if prop, has := s.props[key]; has {
+		return key, prop
+	}
+	key = indexPattern.ReplaceAllString(key, "_"+indexPlaceholder+"$1")
+	// 连续的下标需要替换两次, 例如 a_0_1
+	key = indexPattern.ReplaceAllString(key, "_"+indexPlaceholder+"$1")
+	return key, s.props[key]
+}
+
+// structType 根据 object 类型的属性创建结构体, 字段的 conf 标签由属性的关键字生成
+func (s *schema) structType(node *yaml.Node, prefix string) (reflect.Type, error) {
+	required := make(map[string]bool)
+	if list := yamlnode.Value(node, "required"); list != nil {
+		for _, item := range list.Content {
+			required[item.Value] = true
+		}
+	}
+	var fields []reflect.StructField
+	if properties := yamlnode.Value(node, "properties"); properties != nil {
+		for i := 0; i+1 < len(properties.Content); i += 2 {
+			key, prop := properties.Content[i].Value, properties.Content[i+1]
+			fullKey := prefix + "_" + key
+			s.props[fullKey] = prop
+			s.required[fullKey] = required[key]
+			typ, err := s.fieldType(prop, fullKey)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, reflect.StructField{
+				Name: fmt.Sprintf("F%d", i/2),
+				Type: typ,
+				Tag:  reflect.StructTag("conf:" + strconv.Quote(fieldTag(key, prop, required[key]))),
+			})
+		}
+	}
+	return reflect.StructOf(fields), nil
+}
+
+// fieldType 返回属性对应的字段类型
+func (s *schema) fieldType(prop *yaml.Node, key string) (reflect.Type, error) {
+	switch format := scalarValue(prop, "format"); {
+	case format == "byte-size":
+		return reflect.TypeOf(conf.ByteSize(0)), nil
+	case format == "percent":
+		return reflect.TypeOf(conf.Percent(0)), nil
+	case hasType(prop, "object"):
+		return s.structType(prop, key)
+	case hasType(prop, "array"):
+		items := yamlnode.Value(prop, "items")
+		if items == nil {
+			return nil, errors.New(fmt.Sprintf("%s array without items", key))
+		}
+		if hasType(items, "object") {
+			elem, err := s.structType(items, key+"_"+indexPlaceholder)
+			if err != nil {
+				return nil, err
+			}
+			return reflect.SliceOf(elem), nil
+		}
+		elem, err := s.fieldType(items, key)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.SliceOf(elem), nil
+	case hasType(prop, "integer"):
+		return reflect.TypeOf(int64(0)), nil
+	case hasType(prop, "number"):
+		return reflect.TypeOf(float64(0)), nil
+	case hasType(prop, "boolean"):
+		return reflect.TypeOf(false), nil
+	case hasType(prop, "string"):
+		return reflect.TypeOf(""), nil
+	}
+	return nil, errors.New(fmt.Sprintf("%s type %s not support", key, nodeString(yamlnode.Value(prop, "type"))))
+}
+
+// fieldTag 根据属性的 default, enum 以及范围生成 conf 标签
+// 标签中的逗号和等号是分隔符, 包含它们的值无法表示, 会被忽略
+func fieldTag(key string, prop *yaml.Node, required bool) string {
+	options := []string{key}
+	add := func(name string, value string) {
+		if value == "" || strings.ContainsAny(value, ",=") {
+			return
+		}
+		options = append(options, name+"="+value)
+	}
+	if def := yamlnode.Value(prop, "default"); def != nil {
+		add("default", listValue(def))
+	}
+	if required {
+		options = append(options, "required=true")
+	}
+	if scalarValue(prop, "deprecated") == "true" {
+		options = append(options, "deprecated=true")
+	}
+	enum := yamlnode.Value(prop, "enum")
+	if items := yamlnode.Value(prop, "items"); enum == nil && items != nil {
+		enum = yamlnode.Value(items, "enum")
+	}
+	if enum != nil {
+		add("enum", listValue(enum))
+	}
+	for _, name := range []string{"minimum", "minLength", "minItems"} {
+		add("min", scalarValue(prop, name))
+	}
+	for _, name := range []string{"maximum", "maxLength", "maxItems"} {
+		add("max", scalarValue(prop, name))
+	}
+	return strings.Join(options, ",")
+}
+
+func hasType(prop *yaml.Node, kind string) bool {
+	typ := yamlnode.Value(prop, "type")
+	if typ == nil {
+		return false
+	}
+	if typ.Kind == yaml.ScalarNode {
+		return typ.Value == kind
+	}
+	for _, item := range typ.Content {
+		if item.Value == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func scalarValue(node *yaml.Node, key string) string {
+	value := yamlnode.Value(node, key)
+	if value == nil || value.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return value.Value
+}
+
+// listValue 返回节点的值, 序列使用 | 连接, 与标签中列表的写法一致
+func listValue(node *yaml.Node) string {
+	if node.Kind != yaml.SequenceNode {
+		return node.Value
+	}
+	var items []string
+	for _, item := range node.Content {
+		items = append(items, item.Value)
+	}
+	return strings.Join(items, "|")
+}
+
+// nodeString 返回节点的可读形式, 序列使用逗号连接
+func nodeString(node *yaml.Node) string {
+	if node == nil {
+		return ""
+	}
+	if node.Kind != yaml.SequenceNode {
+		return node.Value
+	}
+	var items []string
+	for _, item := range node.Content {
+		items = append(items, nodeString(item))
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+var ErrToml = errors.New("toml load err")
+
+var (
+	tomlHeaderPattern = regexp.MustCompile(`^\s*(\[\[?)\s*([^\]]+?)\s*\]\]?`)
+	tomlKeyPattern    = regexp.MustCompile(`^\s*([A-Za-z0-9_\-."' ]+?)\s*=`)
+)
+
+// decodeToml 解码 toml 文件, 作为 conf.NewYamlWithDecoder 的解码器, 合并, profiles 以及展开的方式与 yaml 相同
+// 表数组转换为元素为 map 的切片, 时间转换为 RFC3339 格式的字符串
+func decodeToml(content []byte) (map[string]interface{}, map[string]int, error) {
+	var data map[string]interface{}
+	_, err := toml.Decode(string(content), &data)
+	if err != nil {
+		return nil, nil, errors.Join(ErrToml, err)
+	}
+	return tomlValue(data).(map[string]interface{}), tomlLines(string(content)), nil
+}
+
+func tomlValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		for key, item := range vv {
+			vv[key] = tomlValue(item)
+		}
+		return vv
+	case []map[string]interface{}:
+		items := make([]interface{}, 0, len(vv))
+		for _, item := range vv {
+			items = append(items, tomlValue(item))
+		}
+		return items
+	case []interface{}:
+		for i, item := range vv {
+			vv[i] = tomlValue(item)
+		}
+		return vv
+	case time.Time:
+		return vv.Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+// tomlLines 逐行扫描文件, 返回每个键所在的行号, 键使用 _ 连接, 表数组的元素按下标展开
+// toml 解析器不提供位置信息, 多行字符串中形如 key = value 的内容可能被误认为键, 只影响位置信息
+func tomlLines(content string) map[string]int {
+	lines := make(map[string]int)
+	arrays := make(map[string]int)
+	prefix := ""
+	for i, line := range strings.Split(content, "\n") {
+		if header := tomlHeaderPattern.FindStringSubmatch(line); header != nil {
+			parts := tomlKeyParts(header[2])
+			path := strings.Join(parts, ".")
+			if header[1] == "[[" {
+				arrays[path]++
+			}
+			// 表数组中的表需要加上元素的下标
+			var key []string
+			for j, part := range parts {
+				key = append(key, part)
+				if n, ok := arrays[strings.Join(parts[:j+1], ".")]; ok {
+					key = append(key, strconv.Itoa(n-1))
+				}
+			}
+			prefix = strings.Join(key, "_") + "_"
+			if _, has := lines[strings.TrimSuffix(prefix, "_")]; !has {
+				lines[strings.TrimSuffix(prefix, "_")] = i + 1
+			}
+			continue
+		}
+		if match := tomlKeyPattern.FindStringSubmatch(line); match != nil {
+			lines[prefix+strings.Join(tomlKeyParts(match[1]), "_")] = i + 1
+		}
+	}
+	return lines
+}
+
+func tomlKeyParts(key string) []string {
+	var parts []string
+	for _, part := range strings.Split(key, ".") {
+		parts = append(parts, strings.Trim(strings.TrimSpace(part), `"'`))
+	}
+	return parts
+}
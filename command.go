@@ -0,0 +1,149 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrUnknownCommand = errors.New("unknown command")
+	ErrHelp           = errors.New("help requested")
+)
+
+type command struct {
+	name    string
+	structs []*service
+}
+
+// RegisterCommand 注册子命令以及子命令使用的配置结构体
+// 命令行中第一个位置参数作为子命令, 只有被选中的子命令的结构体和全局结构体会被注册
+func (x *X) RegisterCommand(name string, structs ...interface{}) {
+	cmd := &command{name: name}
+	for _, f := range structs {
+		if reflect.TypeOf(f).Kind() != reflect.Ptr {
+			x.handler(NewParseResultError(ErrRegisterConfigNotPtr))
+			return
+		}
+		cmd.structs = append(cmd.structs, &service{
+			Conf: f,
+		})
+	}
+	x.commands = append(x.commands, cmd)
+}
+
+// Command 返回被选中的子命令, 没有选中时返回空
+func (x *X) Command() string {
+	return x.command
+}
+
+// CommandArgs 返回子命令之后剩余的位置参数
+func (x *X) CommandArgs() []string {
+	return x.commandArgs
+}
+
+func (x *X) hasCommands() bool {
+	return len(x.commands) > 0
+}
+
+func (x *X) findCommand(name string) *command {
+	for _, cmd := range x.commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// selectCommand 选中子命令, 并注册子命令的结构体
+func (x *X) selectCommand(name string) error {
+	cmd := x.findCommand(name)
+	if cmd == nil {
+		return errors.Join(ErrUnknownCommand, errors.New(fmt.Sprintf("command:%s", name)))
+	}
+	x.command = name
+	for _, model := range cmd.structs {
+		x.parseStruct(model)
+		x.structs = append(x.structs, model)
+	}
+	return nil
+}
+
+// commandSource 可选接口, 返回配置源中选择的子命令, 例如命令行中的第一个位置参数
+type commandSource interface {
+	commandName() string
+}
+
+// selectSourceCommand 在解析配置源之前选中子命令, 子命令不存在时由配置源在解析时报告
+func (x *X) selectSourceCommand() {
+	if !x.hasCommands() || x.command != "" {
+		return
+	}
+	for _, source := range x.sources {
+		s, ok := source.(commandSource)
+		if !ok {
+			continue
+		}
+		if name := s.commandName(); name != "" && x.findCommand(name) != nil {
+			_ = x.selectCommand(name)
+			return
+		}
+	}
+}
+
+// PrintUsage 输出所有已注册参数的帮助信息, 包括被选中的子命令的参数
+// 没有选中子命令时列出所有子命令
+func (x *X) PrintUsage(w io.Writer) {
+	if x.command != "" {
+		_, _ = fmt.Fprintf(w, "Usage of %s:\n", x.command)
+	} else {
+		_, _ = fmt.Fprintf(w, "Usage:\n")
+	}
+	x.writeUsage(w, x.argTree, []string{})
+	if x.command == "" && x.hasCommands() {
+		var names []string
+		for _, cmd := range x.commands {
+			names = append(names, cmd.name)
+		}
+		sort.Strings(names)
+		_, _ = fmt.Fprintf(w, "Commands:\n  %s\n", strings.Join(names, "\n  "))
+	}
+}
+
+// CommandUsage 输出子命令自己的参数的帮助信息
+func (x *X) CommandUsage(name string, w io.Writer) error {
+	cmd := x.findCommand(name)
+	if cmd == nil {
+		return errors.Join(ErrUnknownCommand, errors.New(fmt.Sprintf("command:%s", name)))
+	}
+	// 在独立的实例中解析子命令的结构体, 不影响当前的参数
+	tmp := New(WithResultHandler(x.handler))
+	for _, model := range cmd.structs {
+		tmp.parseStruct(&service{Conf: model.Conf, Name: model.Name})
+	}
+	_, _ = fmt.Fprintf(w, "Usage of %s:\n", name)
+	tmp.writeUsage(w, tmp.argTree, []string{})
+	return nil
+}
+
+func (x *X) writeUsage(w io.Writer, tree *argTree, prefix []string) {
+	x.rangeArgTree(tree, prefix, func(path []string, arg Arg) {
+		key := strings.Join(path, "_")
+		// 布尔参数同时显示取反的形式
+		if _, ok := arg.(*Bool); ok {
+			_, _ = fmt.Fprintf(w, "  -%s, -%s%s\n", key, negationPrefix, key)
+		} else {
+			_, _ = fmt.Fprintf(w, "  -%s\n", key)
+		}
+		line := arg.GetDescription()
+		if def := maskDefault(arg); def != "" {
+			line = strings.TrimSpace(fmt.Sprintf("%s (default %s)", line, def))
+		}
+		if line != "" {
+			_, _ = fmt.Fprintf(w, "    \t%s\n", line)
+		}
+	})
+}
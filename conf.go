@@ -3,8 +3,14 @@ package conf
 import (
 	"errors"
 	"fmt"
+	"log/slog"
+	"os"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type X struct {
@@ -14,12 +20,51 @@ type X struct {
 	kv      *kv[Arg]
 	handler ConfigResultHandler
 	result  []ConfigResult
+	// 当前激活的环境, 例如 dev, staging, prod
+	profiles []string
+	// 严格模式, 以及配置源中未注册的参数
+	strict  StrictMode
+	unknown []unknownKey
+	// 正在设置参数的配置源, 结构体切片元素中未注册的字段记录为来自该配置源
+	parsing Source
+	// 子命令, 以及命令行中选中的子命令和剩余的位置参数
+	commands    []*command
+	command     string
+	commandArgs []string
+	// 绑定位置参数的Arg
+	positions []position
+	// 读取环境变量, 默认为 os.LookupEnv
+	lookupEnv func(key string) (string, bool)
+	// 所有的结构体切片
+	slices []*StructSlice
+	// 参数变更的回调
+	listeners []func(keys []string)
+	// 参数注册时的值, 包括标签中的默认值
+	baseline map[string]argState
+	// 加载配置的统计信息, 以及用户提供的指标
+	stats   Stats
+	metrics Metrics
+	// Reload 与 Handler, Publish 之间的并发控制
+	mu sync.RWMutex
+	// 结构化日志, 以及是否通过 WithResultHandler 指定了 handler
+	logger        *slog.Logger
+	parseLogger   ParseLogger
+	customHandler bool
+	// 本次解析中请求了帮助信息, 不再解析之后的配置源
+	helpRequested bool
+}
+
+type position struct {
+	key   string
+	index int
 }
 
 type argTree struct {
 	key   string
 	value string
 	child []*argTree
+	// 结构体切片的节点, 子节点为每个元素
+	slice *StructSlice
 }
 
 func newArgTree(key string, defValue string) *argTree {
@@ -36,13 +81,18 @@ func (a *argTree) AppendChild(child *argTree) {
 
 func New(bfs ...BuildFunc) *X {
 	ret := &X{
-		kv:      newKV[Arg](),
-		argTree: &argTree{},
-		handler: resultHandler,
+		kv:        newKV[Arg](),
+		argTree:   &argTree{},
+		lookupEnv: os.LookupEnv,
+		baseline:  make(map[string]argState),
+		stats:     Stats{SourceParseDuration: make(map[string]time.Duration)},
 	}
 	for _, bf := range bfs {
 		bf(ret)
 	}
+	if !ret.customHandler {
+		ret.handler = defaultHandler(ret.logger, ret.parseLogger)
+	}
 	return ret
 }
 
@@ -51,7 +101,55 @@ type BuildFunc func(x *X)
 func WithResultHandler(l ConfigResultHandler) BuildFunc {
 	return func(x *X) {
 		x.handler = l
+		x.customHandler = true
+	}
+}
+
+// WithLookupEnv 指定读取环境变量的方法, 用于测试或者嵌入到其他程序中
+func WithLookupEnv(lookup func(key string) (string, bool)) BuildFunc {
+	return func(x *X) {
+		x.lookupEnv = lookup
+	}
+}
+
+// WithEnviron 使用 key=value 形式的列表作为环境变量, 格式与 os.Environ() 一致
+func WithEnviron(environ []string) BuildFunc {
+	env := make(map[string]string)
+	for _, item := range environ {
+		key, value, _ := strings.Cut(item, "=")
+		env[key] = value
+	}
+	return WithLookupEnv(func(key string) (string, bool) {
+		value, has := env[key]
+		return value, has
+	})
+}
+
+func (x *X) getenv(key string) string {
+	value, _ := x.lookupEnv(key)
+	return value
+}
+
+// WithProfile 通过代码指定激活的环境
+func WithProfile(profiles ...string) BuildFunc {
+	return func(x *X) {
+		x.profiles = profiles
+	}
+}
+
+// ProfileEnv 未通过参数或代码指定环境时, 从该环境变量中读取, 多个环境用逗号分隔
+const ProfileEnv = "CONF_PROFILE"
+
+func (x *X) SetProfile(profiles ...string) {
+	x.profiles = profiles
+}
+
+// Profiles 返回当前激活的环境
+func (x *X) Profiles() []string {
+	if len(x.profiles) > 0 {
+		return x.profiles
 	}
+	return splitList(x.getenv(ProfileEnv))
 }
 
 var (
@@ -59,6 +157,8 @@ var (
 	ErrArgSetValue          = errors.New("set value err")
 	ErrFieldTypeNotSupport  = errors.New("field type not support")
 	ErrArgSetDefaultValue   = errors.New("set default value err")
+	ErrArgPosition          = errors.New("invalid position")
+	ErrArgRule              = errors.New("invalid rule")
 )
 
 func (x *X) RegisterConf(f interface{}) {
@@ -86,24 +186,49 @@ func (x *X) RegisterSource(s Source) {
 	x.sources = append(x.sources, s)
 }
 
-func (x *X) Parse() {
-	// 处理所有注册的结构体 创建对应的参数列表
-	for _, model := range x.structs {
-		x.parseStruct(model)
-	}
+// Parse 解析所有注册的结构体和配置源, 返回期间通过 handler 报告的错误
+// 命令行中有 -h 时输出帮助信息并返回 ErrHelp, 由调用方决定是否退出
+func (x *X) Parse() error {
+	start := time.Now()
+	err := x.collectErrors(true, func() {
+		// 处理所有注册的结构体 创建对应的参数列表
+		for _, model := range x.structs {
+			x.parseStruct(model)
+		}
+		// 在所有配置源之前选中子命令, 使所有配置源都可以设置子命令的参数
+		x.selectSourceCommand()
+		x.parseSources()
+	})
+	x.observeReload(start, err)
+	return err
+}
+
+// parseSources 依次解析所有配置源并设置参数, 然后校验所有参数
+func (x *X) parseSources() {
+	var deprecated []string
+	x.helpRequested = false
 	// 处理所有注册的配置源
 	for _, source := range x.sources {
+		start := time.Now()
+		count := 0
 		source.Parse()
+		// 已经输出帮助信息, 不再解析和校验
+		if x.helpRequested {
+			return
+		}
 		// 将配置源中的配置参数设置到对应的参数列表中
+		x.parsing = source
 		source.Range(func(key string, value interface{}) bool {
-			arg, has := x.kv.Get(key)
-			// 如果配置源中的配置参数在参数列表中不存在，那么就忽略
+			count++
+			arg, has := x.lookupArg(key)
+			// 如果配置源中的配置参数在参数列表中不存在，那么就忽略, 严格模式下记录下来
 			if !has {
-				return false
+				x.addUnknown(source, key)
+				return true
 			}
 			// 如果参数已经被优先级更高的配置源设置过，那么就忽略
 			if arg.HasSet() {
-				return false
+				return true
 			}
 			// 将配置源中的配置参数设置到对应的参数列表中
 			err := arg.SetValue(value)
@@ -113,12 +238,35 @@ func (x *X) Parse() {
 					errors.New(fmt.Sprintf("arg %s SetValue %v", key, value)),
 					err,
 				))
-				return false
+				return true
 			}
-			// 如果没有报错，那么就设置参数已经被设置过的标志
+			// 如果没有报错，那么就设置参数已经被设置过的标志, 并记录来源
 			arg.Set()
+			setOrigin(arg, sourceOrigin(source, key))
+			x.log(slog.LevelDebug, "config key set", "key", key, "source", argOrigin(arg), "value", maskValue(arg))
+			if message := x.checkDeprecated(key, arg); message != "" {
+				deprecated = append(deprecated, message)
+			}
 			return true
 		})
+		x.parsing = nil
+		duration := time.Since(start)
+		x.log(slog.LevelInfo, "config source loaded", "source", sourceName(source), "keys", count, "duration", duration)
+		x.observeSource(source, duration)
+	}
+	if len(deprecated) > 0 {
+		x.handler(NewParseResultWarning(deprecated...))
+	}
+	// 报告没有设置任何字段的元素
+	x.checkSliceGaps()
+	// 将结构体切片的元素写回字段
+	x.flushSlices()
+	// 报告所有配置源中未注册的参数
+	x.reportUnknown()
+	// 校验所有参数
+	err := x.validate()
+	if err != nil {
+		x.handler(NewParseResultError(err))
 	}
 }
 
@@ -126,6 +274,11 @@ type Var struct {
 	Default string
 	Name    string
 	Desc    string
+	Secret  bool
+	// 绑定的位置参数下标, 切片会绑定该下标之后的所有位置参数
+	Pos string
+	// 校验规则
+	Rule Rule
 }
 
 type service struct {
@@ -199,6 +352,34 @@ func (x *X) parseTag(tree *argTree, conf reflect.Value, tags ...string) {
 				attr.Default = kvList[1]
 			case "usage":
 				attr.Desc = kvList[1]
+			case "secret":
+				attr.Secret, _ = strconv.ParseBool(kvList[1])
+			case "pos":
+				attr.Pos = kvList[1]
+			case "required":
+				attr.Rule.Required, _ = strconv.ParseBool(kvList[1])
+			case "enum":
+				attr.Rule.Enum = strings.Split(kvList[1], "|")
+			case "deprecated":
+				// deprecated=true 或者 deprecated=<替代的参数说明>
+				deprecated, err := strconv.ParseBool(kvList[1])
+				attr.Rule.Deprecated = err != nil || deprecated
+				if err != nil {
+					attr.Rule.DeprecatedMessage = kvList[1]
+				}
+			case "min", "max":
+				bound, err := strconv.ParseFloat(kvList[1], 64)
+				if err != nil {
+					x.handler(NewParseResultError(ErrArgRule,
+						errors.New(fmt.Sprintf("field:%s %s:%s", field.Name, kvList[0], kvList[1])),
+					))
+					continue
+				}
+				if kvList[0] == "min" {
+					attr.Rule.Min = &bound
+				} else {
+					attr.Rule.Max = &bound
+				}
 			default:
 			}
 		}
@@ -222,11 +403,26 @@ func (x *X) parseTag(tree *argTree, conf reflect.Value, tags ...string) {
 				errors.New(fmt.Sprintf("field:%s, key:%s, type:ptr", field.Name, key)),
 			))
 			return
-		// TODO: 额外处理
 		case reflect.Slice:
-			x.handler(NewParseResultError(ErrFieldTypeNotSupport,
-				errors.New(fmt.Sprintf("field:%s, key:%s, type:slice", field.Name, key)),
-			))
+			// 元素为结构体的切片, 每个元素的字段注册为独立的参数
+			if field.Type.Elem().Kind() == reflect.Struct {
+				sliceTree := newArgTree(attr.Name, "")
+				slice := newStructSlice(x, &value, sliceTree, append(append([]string{}, tags...), attr.Name))
+				slice.SetDescription(attr.Desc)
+				x.slices = append(x.slices, slice)
+				x.kv.Set(key, slice)
+				tree.AppendChild(sliceTree)
+				continue
+			}
+			// 只支持元素为标量的切片
+			elem := reflect.New(field.Type.Elem()).Elem()
+			if newScalarArg(&elem) == nil {
+				x.handler(NewParseResultError(ErrFieldTypeNotSupport,
+					errors.New(fmt.Sprintf("field:%s, key:%s, type:slice of %s", field.Name, key, field.Type.Elem().Kind())),
+				))
+				break
+			}
+			arg = NewSlice(&value)
 		// TODO: 额外处理
 		case reflect.Map:
 			x.handler(NewParseResultError(ErrFieldTypeNotSupport,
@@ -244,10 +440,11 @@ func (x *X) parseTag(tree *argTree, conf reflect.Value, tags ...string) {
 			arg = NewString(&value)
 		case reflect.Int, reflect.Int32, reflect.Int64, reflect.Int16, reflect.Int8:
 			arg = NewInt(&value)
+		// ByteSize 和 Percent 在 newScalarArg 中处理
 		case reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uint16, reflect.Uint8:
-			arg = NewUint(&value)
+			arg = newScalarArg(&value)
 		case reflect.Float64, reflect.Float32:
-			arg = NewFloat(&value)
+			arg = newScalarArg(&value)
 		case reflect.Bool:
 			arg = NewBool(&value)
 		default:
@@ -255,19 +452,47 @@ func (x *X) parseTag(tree *argTree, conf reflect.Value, tags ...string) {
 				errors.New(fmt.Sprintf("field:%s, key:%s, type: unknown", field.Name, key)),
 			))
 		}
+		// 不支持的类型已经通过 handler 报告
+		if arg == nil {
+			continue
+		}
+		// 记录绑定位置参数的Arg
+		if attr.Pos != "" {
+			index, err := strconv.Atoi(attr.Pos)
+			if err != nil || index < 0 {
+				x.handler(NewParseResultError(ErrArgPosition,
+					errors.New(fmt.Sprintf("key:%s pos:%s", key, attr.Pos)),
+				))
+			} else {
+				x.positions = append(x.positions, position{key: key, index: index})
+			}
+		}
 		// 设置Arg默认值
 		arg.SetDefaultValue(attr.Default)
 		if attr.Default != "" {
-			err := arg.SetValue(attr.Default)
+			defValue := attr.Default
+			// 标签中逗号用于分隔选项, 切片的默认值使用 | 分隔
+			if _, ok := arg.(*Slice); ok {
+				defValue = strings.ReplaceAll(defValue, "|", ",")
+			}
+			err := arg.SetValue(defValue)
 			if err != nil {
 				x.handler(NewParseResultError(ErrArgSetDefaultValue,
 					errors.New(fmt.Sprintf("key:%s default:%v", key, attr.Default)),
 					err,
 				))
+			} else {
+				setOrigin(arg, OriginDefault)
 			}
 		}
 		// 设置Arg描述
 		arg.SetDescription(attr.Desc)
+		// 设置Arg是否为敏感信息, 输出时会被隐藏
+		setSecret(arg, attr.Secret)
+		// 设置Arg校验规则, 在 Parse 结束时校验
+		setRule(arg, attr.Rule)
+		// 记录注册时的值, Reload 时恢复
+		x.baseline[key] = argState{value: arg.GetValue(), origin: argOrigin(arg)}
 		// 将该Arg注册到conf的KV中
 		x.kv.Set(key, arg)
 		// 将该Arg注册到tree中
@@ -276,6 +501,9 @@ func (x *X) parseTag(tree *argTree, conf reflect.Value, tags ...string) {
 }
 
 func (x *X) Get(key string) (interface{}, bool) {
+	// 与 Reload 互斥, 例如 RemoteSource.Watch 在后台 Reload
+	x.mu.RLock()
+	defer x.mu.RUnlock()
 	arg, has := x.kv.Get(key)
 	if !has {
 		return nil, false
@@ -283,27 +511,173 @@ func (x *X) Get(key string) (interface{}, bool) {
 	return arg.GetValue(), true
 }
 
+const (
+	// OriginDefault 值来自标签中的默认值
+	OriginDefault = "default"
+	// OriginSet 值来自 X.Set 或 X.SetMany
+	OriginSet = "set"
+)
+
+// Set 设置参数的值, 并标记为已设置, 值不满足标签中的规则时不修改参数并返回 ErrValidate
+// 参数不存在时, 严格模式下返回 ErrUnknownKey, 否则创建一个不限类型的参数
 func (x *X) Set(key string, value interface{}) error {
+	return x.setMany(map[string]interface{}{key: value}, x.strict == StrictError)
+}
+
+// SetMany 原子地设置多个参数, 所有的值都设置成功并满足规则才会生效, 否则不修改任何参数并返回错误
+// 成功后只触发一次变更通知
+func (x *X) SetMany(values map[string]interface{}) error {
+	return x.setMany(values, x.strict == StrictError)
+}
+
+// setMany strict 为 true 时拒绝不存在的参数, 与 Reload 互斥, 释放锁之后通知
+func (x *X) setMany(values map[string]interface{}, strict bool) error {
+	x.mu.Lock()
+	keys, err := x.setValues(values, strict)
+	x.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	x.notify(keys)
+	return nil
+}
+
+// setValues 先在参数的副本上设置并校验所有的值, 全部通过后才修改参数, 返回修改的参数
+func (x *X) setValues(values map[string]interface{}, strict bool) ([]string, error) {
+	defer x.flushSlices()
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// 通过下标新增的元素, 下标需要从当前的长度开始连续
+	added := make(map[*StructSlice]map[int]bool)
+	for _, key := range keys {
+		err := x.checkSet(key, values[key], strict, added)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for slice, indexes := range added {
+		for i := range indexes {
+			if i >= slice.Len()+len(indexes) {
+				return nil, errors.Join(ErrStructSliceIndex, errors.New(fmt.Sprintf("%s index %d exceeds length %d", slice.key(), i, slice.Len())))
+			}
+		}
+	}
+
+	args := make([]Arg, len(keys))
+	for i, key := range keys {
+		arg, has := x.lookupArg(key)
+		if !has {
+			arg = NewInterface(values[key])
+			x.kv.Set(key, arg)
+		}
+		err := arg.SetValue(values[key])
+		if err != nil {
+			return nil, errors.Join(ErrArgSetValue, errors.New(fmt.Sprintf("arg %s SetValue %v", key, values[key])), err)
+		}
+		args[i] = arg
+	}
+	// 整体设置结构体切片时元素中未注册的字段
+	x.reportUnknown()
+	for i, arg := range args {
+		arg.Set()
+		setOrigin(arg, OriginSet)
+		x.log(slog.LevelInfo, "config key set", "key", keys[i], "source", OriginSet, "value", maskValue(arg))
+		x.checkDeprecated(keys[i], arg)
+	}
+	return keys, nil
+}
+
+// checkSet 在参数的副本上设置并校验值, 不修改参数
+// 超过当前长度的下标使用示例元素中的参数校验, 并记录到 added 中
+func (x *X) checkSet(key string, value interface{}, strict bool, added map[*StructSlice]map[int]bool) error {
 	arg, has := x.kv.Get(key)
 	if !has {
-		x.kv.Set(key, NewInterface(value))
+		for _, slice := range x.slices {
+			i, ok := slice.index(key)
+			if !ok || i < slice.Len() {
+				continue
+			}
+			tmp, _ := slice.example()
+			sub := strings.TrimPrefix(key, slice.key()+"_"+strconv.Itoa(i)+"_")
+			arg, has = tmp.lookupArg(sub)
+			if !has {
+				continue
+			}
+			if added[slice] == nil {
+				added[slice] = make(map[int]bool)
+			}
+			added[slice][i] = true
+			break
+		}
+	}
+	if !has {
+		if strict {
+			return errors.Join(ErrUnknownKey, errors.New(fmt.Sprintf("key:%s", key)))
+		}
 		return nil
 	}
-	err := arg.SetValue(value)
-	return err
+	scratch, err := x.scratchArg(arg, strict)
+	if err != nil {
+		return err
+	}
+	err = scratch.SetValue(value)
+	if err != nil {
+		return errors.Join(ErrArgSetValue, errors.New(fmt.Sprintf("arg %s SetValue %v", key, value)), err)
+	}
+	err = validateValue(key, scratch)
+	if err != nil {
+		return errors.Join(ErrValidate, err)
+	}
+	// 整体设置结构体切片时校验元素中设置的字段
+	if slice, ok := scratch.(*StructSlice); ok {
+		slice.x.kv.Range(func(key string, arg Arg) bool {
+			if arg.HasSet() {
+				err = validateValue(key, arg)
+			}
+			return err == nil
+		})
+		if err != nil {
+			return errors.Join(ErrValidate, err)
+		}
+	}
+	return nil
+}
+
+// OnChange 注册参数变更的回调, 参数通过 Set 或 SetMany 修改后调用
+func (x *X) OnChange(f func(keys []string)) {
+	x.listeners = append(x.listeners, f)
+}
+
+func (x *X) notify(keys []string) {
+	for _, listener := range x.listeners {
+		listener(keys)
+	}
 }
 
 type ConfigResult struct {
-	Key     string
-	Value   interface{}
-	Default string
-	Usage   string
+	Key     string      `json:"key" yaml:"key"`
+	Value   interface{} `json:"value" yaml:"value"`
+	Default string      `json:"default,omitempty" yaml:"default,omitempty"`
+	Usage   string      `json:"usage,omitempty" yaml:"usage,omitempty"`
+	// 值的来源, 例如 default, flag, yaml (config.yaml:3), set
+	Origin string `json:"origin,omitempty" yaml:"origin,omitempty"`
+	// 未隐藏的值, 用于比较敏感信息是否变化
+	raw interface{}
 }
 
 type ParseResult struct {
 	Err        error
 	ErrMessage string
-	configs    []ConfigResult
+	// 当前激活的环境
+	Profiles []string
+	// 不影响解析的警告信息, 例如严格模式下的未知参数
+	Warnings []string
+	configs  []ConfigResult
+	diffs    []ConfigDiff
 }
 
 func NewParseResultError(err ...error) *ParseResult {
@@ -322,6 +696,12 @@ func NewParseResultError(err ...error) *ParseResult {
 	}
 }
 
+func NewParseResultWarning(warnings ...string) *ParseResult {
+	return &ParseResult{
+		Warnings: warnings,
+	}
+}
+
 func NewParseResult(configs []ConfigResult) *ParseResult {
 	return &ParseResult{
 		Err:     nil,
@@ -329,33 +709,102 @@ func NewParseResult(configs []ConfigResult) *ParseResult {
 	}
 }
 
+// NewParseResultDiff 创建包含配置差异的结果, 由 PrintDiff 使用
+func NewParseResultDiff(diffs []ConfigDiff) *ParseResult {
+	return &ParseResult{
+		diffs: diffs,
+	}
+}
+
+// Configs 返回 PrintResult 输出的所有参数
+func (p *ParseResult) Configs() []ConfigResult {
+	return p.configs
+}
+
+// Diffs 返回 PrintDiff 输出的配置差异, 可以通过 DiffText 或 json.Marshal 输出
+func (p *ParseResult) Diffs() []ConfigDiff {
+	return p.diffs
+}
+
 type ConfigResultHandler func(*ParseResult)
 
+// PrintResult 通过 handler 输出所有参数的值, 释放锁之后调用 handler
 func (x *X) PrintResult() {
+	x.mu.RLock()
 	// 根据 argTree 进行递归打印
-	x.printArgTree(x.argTree, []string{})
-	x.handler(NewParseResult(x.result))
+	result := NewParseResult(x.snapshot())
+	result.Profiles = x.Profiles()
+	x.mu.RUnlock()
+	x.handler(result)
 }
 
-func (x *X) printArgTree(tree *argTree, prefix []string) {
-	// 叶子节点 打印参数
-	if len(tree.child) == 0 {
-		key := strings.Join(append(prefix, tree.key), "_")
-		arg, _ := x.kv.Get(key)
-		x.result = append(x.result, ConfigResult{
-			Key:     key,
-			Value:   arg.GetValue(),
-			Default: arg.GetDefaultValue(),
+// Snapshot 返回当前所有参数的值, 敏感信息会被隐藏, 可以用于 Diff
+func (x *X) Snapshot() []ConfigResult {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.snapshot()
+}
+
+func (x *X) snapshot() []ConfigResult {
+	return x.configResults(x.argTree, []string{})
+}
+
+func (x *X) configResults(tree *argTree, prefix []string) []ConfigResult {
+	var configs []ConfigResult
+	x.rangeArgTree(tree, prefix, func(path []string, arg Arg) {
+		configs = append(configs, ConfigResult{
+			Key:     strings.Join(path, "_"),
+			Value:   maskValue(arg),
+			Default: maskDefault(arg),
 			Usage:   arg.GetDescription(),
+			Origin:  argOrigin(arg),
+			raw:     arg.GetValue(),
 		})
+	})
+	return configs
+}
+
+// rangeArgTree 按照注册顺序遍历 tree 下所有的参数, path 为参数的完整路径
+func (x *X) rangeArgTree(tree *argTree, prefix []string, f func(path []string, arg Arg)) {
+	// 叶子节点 处理参数
+	if len(tree.child) == 0 {
+		path := append(append([]string{}, prefix...), tree.key)
+		arg, has := x.kv.Get(strings.Join(path, "_"))
+		if !has {
+			return
+		}
+		// 没有元素的结构体切片
+		if _, ok := arg.(*StructSlice); ok {
+			return
+		}
+		f(path, arg)
 		return
 	}
-	// 非叶子节点 递归打印
+	// 非叶子节点 递归处理
 	for _, child := range tree.child {
 		nextPrefix := prefix
 		if tree.key != "" {
-			nextPrefix = append(prefix, tree.key)
+			nextPrefix = append(append([]string{}, prefix...), tree.key)
 		}
-		x.printArgTree(child, nextPrefix)
+		x.rangeArgTree(child, nextPrefix, f)
+	}
+}
+
+const secretMask = "******"
+
+// maskDefault 返回参数的默认值, 敏感信息返回掩码
+func maskDefault(arg Arg) string {
+	def := arg.GetDefaultValue()
+	if def != "" && isSecret(arg) {
+		return secretMask
+	}
+	return def
+}
+
+// maskValue 返回参数的值, 敏感信息返回掩码
+func maskValue(arg Arg) interface{} {
+	if isSecret(arg) {
+		return secretMask
 	}
+	return arg.GetValue()
 }
@@ -1,15 +1,30 @@
 package conf_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
 	"github.com/innsanes/conf"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v3"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 // test 函数会有默认的flag传入参数和flag.Parse()
-// 所以在测试中需要在flag.Parse()之后再设置一下 os.Args, 也就是每个Test开始之前
+// 所以在测试中通过 NewFlagWithArgs 指定参数, 不使用 os.Args
 
 func init() {
 	// 在测试开始前删除test文件夹下面的所有  .yaml 文件
@@ -29,9 +44,8 @@ type TestFlagTypeStruct struct {
 
 // 测试 string, int, bool 三个常见类型
 func TestFlagType(t *testing.T) {
-	os.Args = []string{"", "-t_string=1", "-t_int=2", "-t_bool=true"}
 	var x = conf.New()
-	flag := conf.NewFlag(x)
+	flag := conf.NewFlagWithArgs(x, []string{"-t_string=1", "-t_int=2", "-t_bool=true"})
 	s := &TestFlagTypeStruct{}
 	x.RegisterConfWithName("t", s)
 	x.RegisterSource(flag)
@@ -58,9 +72,8 @@ type TestFlagNestedChild struct {
 
 // 嵌套结构体, 匿名继承, 非匿名继承, 忽略, 以及更改结构体名称
 func TestFlagNested(t *testing.T) {
-	os.Args = []string{"", "-t_a=1", "-t_child_a=2", "-t_c_a=3"}
 	var x = conf.New()
-	flag := conf.NewFlag(x)
+	flag := conf.NewFlagWithArgs(x, []string{"-t_a=1", "-t_child_a=2", "-t_c_a=3"})
 	s := &TestFlagNestedStruct{}
 	x.RegisterConfWithName("t", s)
 	x.RegisterSource(flag)
@@ -84,9 +97,8 @@ type TestYamlStructNest struct {
 // yaml 文件生成, 包括默认值
 func TestYamlGen(t *testing.T) {
 	var filepath = "test/test_gen.yaml"
-	os.Args = []string{"", "-t_struct_name=new", "-t_struct_value=19223", "-yaml_filepath=" + filepath}
 	var x = conf.New()
-	flag := conf.NewFlag(x)
+	flag := conf.NewFlagWithArgs(x, []string{"-t_struct_name=new", "-t_struct_value=19223", "-yaml_filepath=" + filepath})
 	y := conf.NewYaml(x)
 	s := &TestYamlGenStruct{}
 	x.RegisterConfWithName("t", s)
@@ -102,7 +114,30 @@ func TestYamlGen(t *testing.T) {
 	err = yaml.Unmarshal(buf, &ns)
 	assert.Nil(t, err)
 	assert.Equal(t, "nest", ns["t"].(map[string]interface{})["struct"].(map[string]interface{})["name"])
-	assert.Equal(t, "1024", ns["t"].(map[string]interface{})["struct"].(map[string]interface{})["value"])
+	assert.Equal(t, 1024, ns["t"].(map[string]interface{})["struct"].(map[string]interface{})["value"])
+	info, err := os.Stat(filepath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
+
+type TestYamlGenerateStruct struct {
+	Name  string  `conf:"name,default=app,usage=service name"`
+	Port  int     `conf:"port,default=8080,usage=listen port"`
+	Debug bool    `conf:"debug"`
+	Rate  float64 `conf:"rate,default=0.5"`
+	Count uint    `conf:"count"`
+}
+
+// 测试 按需生成 yaml 模板, 保持类型, 字段顺序和注释
+func TestYamlGenerate(t *testing.T) {
+	var x = conf.New()
+	y := conf.NewYaml(x)
+	s := &TestYamlGenerateStruct{}
+	x.RegisterConfWithName("t", s)
+	x.Parse()
+	buf := &bytes.Buffer{}
+	assert.Nil(t, y.Generate(buf))
+	assert.Equal(t, "t:\n  # service name\n  name: app\n  # listen port\n  port: 8080\n  debug: false\n  rate: 0.5\n  count: 0\n", buf.String())
 }
 
 type TestYamlStruct struct {
@@ -119,9 +154,8 @@ type TestYamlNest struct {
 // 测试 使用yaml 设置参数值, conf能否正确识别
 func TestYaml(t *testing.T) {
 	var filepath = "test/test.yaml"
-	os.Args = []string{"", "-yaml_filepath=" + filepath}
 	var x = conf.New()
-	flag := conf.NewFlag(x)
+	flag := conf.NewFlagWithArgs(x, []string{"-yaml_filepath=" + filepath})
 	y := conf.NewYaml(x)
 	s := &TestYamlStruct{}
 	x.RegisterConfWithName("t", s)
@@ -161,9 +195,8 @@ type TestFlagYamlStructNest struct {
 // 测试 yaml 和 flag 的优先级
 func TestFlagYaml(t *testing.T) {
 	var filepath = "test/test_priority.yaml"
-	os.Args = []string{"", "-t_struct_name=flag-name", "-t_struct_value=19000", "-yaml_filepath=" + filepath}
 	var x = conf.New()
-	flag := conf.NewFlag(x)
+	flag := conf.NewFlagWithArgs(x, []string{"-t_struct_name=flag-name", "-t_struct_value=19000", "-yaml_filepath=" + filepath})
 	y := conf.NewYaml(x)
 	s := &TestFlagYamlStruct{}
 	x.RegisterConfWithName("t", s)
@@ -198,9 +231,8 @@ type TestFuncStruct struct {
 // 非 flag 或者 yaml 这类官方配置参数的方式
 // 通过函数调用的方式设置参数
 func TestFunc(t *testing.T) {
-	os.Args = []string{""}
 	var x = conf.New()
-	flag := conf.NewFlag(x)
+	flag := conf.NewFlagWithArgs(x, nil)
 	s := &TestFuncStruct{}
 	x.RegisterConfWithName("t", s)
 	x.RegisterSource(flag)
@@ -218,10 +250,9 @@ type TestSingletonStruct struct {
 
 // 测试单例模式是否正常
 func TestSingleton(t *testing.T) {
-	os.Args = []string{"", "-t_string=CCC"}
 	s := &TestSingletonStruct{}
 	conf.RegisterConfWithName("t", s)
-	flag := conf.NewFlag(conf.GetConf())
+	flag := conf.NewFlagWithArgs(conf.GetConf(), []string{"-t_string=CCC"})
 	conf.RegisterSource(flag)
 	conf.Parse()
 	err := conf.Set("t_string2", "vm50")
@@ -229,4 +260,1542 @@ func TestSingleton(t *testing.T) {
 	conf.PrintResult()
 	assert.Equal(t, "CCC", s.String)
 	assert.Equal(t, "vm50", s.String2)
+	v, err := conf.Value[string]("t_string")
+	assert.Nil(t, err)
+	assert.Equal(t, "CCC", v)
+	assert.Equal(t, "vm50", conf.MustValue[string]("t_string2"))
+	assert.Equal(t, 1, conf.ValueOr("t_missing", 1))
+}
+
+type TestYamlMultiStruct struct {
+	Name   string `conf:"name"`
+	Region string `conf:"region"`
+	Secret string `conf:"secret"`
+	Port   int    `conf:"port"`
+}
+
+// 测试 多个yaml文件按顺序合并, 以及 glob 匹配
+func TestYamlMultiFile(t *testing.T) {
+	assert.Nil(t, os.MkdirAll("test/multi/conf.d", os.ModePerm))
+	assert.Nil(t, os.WriteFile("test/multi/base.yaml", []byte("t:\n  name: base\n  region: base\n  port: 80\n"), os.ModePerm))
+	assert.Nil(t, os.WriteFile("test/multi/conf.d/01-region.yaml", []byte("t:\n  region: eu\n"), os.ModePerm))
+	assert.Nil(t, os.WriteFile("test/multi/conf.d/02-secrets.yaml", []byte("t:\n  secret: s3cr3t\n  port: 8080\n"), os.ModePerm))
+
+	var x = conf.New()
+	flag := conf.NewFlagWithArgs(x, []string{"-yaml_filepath=test/multi/base.yaml,test/multi/conf.d/*.yaml"})
+	y := conf.NewYaml(x)
+	s := &TestYamlMultiStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterConfWithName("yaml", y.YamlConf)
+	x.RegisterSource(flag)
+	x.RegisterSource(y)
+	x.Parse()
+	assert.Equal(t, "base", s.Name)
+	assert.Equal(t, "eu", s.Region)
+	assert.Equal(t, "s3cr3t", s.Secret)
+	assert.Equal(t, 8080, s.Port)
+}
+
+// 测试 include 键和 !include 标签, 路径相对于引用文件
+func TestYamlInclude(t *testing.T) {
+	assert.Nil(t, os.MkdirAll("test/include/sub", os.ModePerm))
+	assert.Nil(t, os.WriteFile("test/include/main.yaml", []byte("include: sub/base.yaml\nt:\n  name: main\n  region: !include region.yaml\n"), os.ModePerm))
+	assert.Nil(t, os.WriteFile("test/include/sub/base.yaml", []byte("t:\n  name: base\n  port: 80\n"), os.ModePerm))
+	assert.Nil(t, os.WriteFile("test/include/region.yaml", []byte("us-east\n"), os.ModePerm))
+
+	var x = conf.New()
+	flag := conf.NewFlagWithArgs(x, []string{"-yaml_filepath=test/include/main.yaml"})
+	y := conf.NewYaml(x)
+	s := &TestYamlMultiStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterConfWithName("yaml", y.YamlConf)
+	x.RegisterSource(flag)
+	x.RegisterSource(y)
+	x.Parse()
+	assert.Equal(t, "main", s.Name)
+	assert.Equal(t, "us-east", s.Region)
+	assert.Equal(t, 80, s.Port)
+}
+
+// 测试 循环引用检测, 错误信息中包含引用链
+func TestYamlIncludeCycle(t *testing.T) {
+	assert.Nil(t, os.MkdirAll("test/cycle", os.ModePerm))
+	assert.Nil(t, os.WriteFile("test/cycle/a.yaml", []byte("include: b.yaml\n"), os.ModePerm))
+	assert.Nil(t, os.WriteFile("test/cycle/b.yaml", []byte("t:\n  name: !include a.yaml\n"), os.ModePerm))
+
+	var parseErr error
+	var x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {
+		if result.Err != nil {
+			parseErr = result.Err
+		}
+	}))
+	flag := conf.NewFlagWithArgs(x, []string{"-yaml_filepath=test/cycle/a.yaml"})
+	y := conf.NewYaml(x)
+	s := &TestYamlMultiStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterConfWithName("yaml", y.YamlConf)
+	x.RegisterSource(flag)
+	x.RegisterSource(y)
+	x.Parse()
+	assert.ErrorIs(t, parseErr, conf.ErrYamlIncludeCycle)
+	assert.Regexp(t, `a\.yaml -> .*b\.yaml -> .*a\.yaml`, parseErr.Error())
+}
+
+// 测试 环境配置, config.<profile>.yaml 覆盖以及文件中的 profiles 段
+func TestYamlProfile(t *testing.T) {
+	assert.Nil(t, os.MkdirAll("test/profile", os.ModePerm))
+	assert.Nil(t, os.WriteFile("test/profile/config.yaml", []byte("t:\n  name: base\n  region: base\n  port: 80\nprofiles:\n  prod:\n    t:\n      port: 443\n      region: section\n"), os.ModePerm))
+	assert.Nil(t, os.WriteFile("test/profile/config.prod.yaml", []byte("t:\n  region: prod\n"), os.ModePerm))
+	assert.Nil(t, os.WriteFile("test/profile/config.staging.yaml", []byte("t:\n  name: staging\n"), os.ModePerm))
+
+	var profiles []string
+	var x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {
+		assert.Nil(t, result.Err)
+		profiles = result.Profiles
+	}))
+	flag := conf.NewFlagWithArgs(x, []string{"-yaml_filepath=test/profile/config.yaml", "-yaml_profile=prod"})
+	y := conf.NewYaml(x)
+	s := &TestYamlMultiStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterConfWithName("yaml", y.YamlConf)
+	x.RegisterSource(flag)
+	x.RegisterSource(y)
+	x.Parse()
+	x.PrintResult()
+	// config.prod.yaml 覆盖文件中的 profiles 段
+	assert.Equal(t, "base", s.Name)
+	assert.Equal(t, "prod", s.Region)
+	assert.Equal(t, 443, s.Port)
+	assert.Equal(t, []string{"prod"}, profiles)
+	assert.Equal(t, "test/profile/config.yaml:8", y.Location("t_port"))
+
+	// glob 匹配时未激活的环境文件不会作为基础文件加载
+	x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {
+		assert.Nil(t, result.Err)
+	}), conf.WithProfile("prod"))
+	y = conf.NewYaml(x)
+	y.YamlConf.FilePath = "test/profile/*.yaml"
+	s = &TestYamlMultiStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(y)
+	x.Parse()
+	assert.Equal(t, "base", s.Name)
+	assert.Equal(t, "prod", s.Region)
+}
+
+type TestExportStruct struct {
+	Name     string             `conf:"name,default=app"`
+	Port     int                `conf:"port,default=8080"`
+	Debug    bool               `conf:"debug"`
+	Password string             `conf:"password,default=123456,secret=true"`
+	Nest     TestYamlStructNest `conf:"nest"`
+}
+
+type TestExportSliceStruct struct {
+	List  []string `conf:"list"`
+	Ports []int    `conf:"ports"`
+}
+
+// 测试 导出解析后的配置, 类型保持不变, 敏感信息被隐藏
+func TestExport(t *testing.T) {
+	var x = conf.New()
+	flag := conf.NewFlagWithArgs(x, []string{"-t_debug", "-t_nest_name=hello world"})
+	s := &TestExportStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(flag)
+	x.Parse()
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, x.Export(buf, conf.ExportYaml))
+	assert.Equal(t, "t:\n  name: app\n  port: 8080\n  debug: true\n  password: '******'\n  nest:\n    name: hello world\n    value: 1024\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, x.Export(buf, conf.ExportJson))
+	data := map[string]map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &data))
+	assert.Equal(t, float64(8080), data["t"]["port"])
+	assert.Equal(t, true, data["t"]["debug"])
+	assert.Equal(t, "******", data["t"]["password"])
+
+	buf.Reset()
+	assert.Nil(t, x.Export(buf, conf.ExportEnv))
+	assert.Equal(t, "T_NAME=app\nT_PORT=8080\nT_DEBUG=true\nT_PASSWORD=\"******\"\nT_NEST_NAME=\"hello world\"\nT_NEST_VALUE=1024\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, x.Export(buf, conf.ExportFlag))
+	assert.Equal(t, "-t_name=app -t_port=8080 -t_debug=true '-t_password=******' '-t_nest_name=hello world' -t_nest_value=1024\n", buf.String())
+
+	assert.ErrorIs(t, x.Export(buf, "toml"), conf.ErrExportFormat)
+
+	// 切片的元素使用逗号连接, 导出的参数可以重新解析
+	x = conf.New()
+	x.RegisterConfWithName("t", &TestExportSliceStruct{})
+	x.RegisterSource(conf.NewFlagWithArgs(x, []string{"-t_list=a,b", "-t_ports=80,443"}))
+	x.Parse()
+	buf.Reset()
+	assert.Nil(t, x.Export(buf, conf.ExportEnv))
+	assert.Equal(t, "T_LIST=a,b\nT_PORTS=80,443\n", buf.String())
+	buf.Reset()
+	assert.Nil(t, x.Export(buf, conf.ExportFlag))
+	assert.Equal(t, "-t_list=a,b -t_ports=80,443\n", buf.String())
+	x = conf.New()
+	s2 := &TestExportSliceStruct{}
+	x.RegisterConfWithName("t", s2)
+	x.RegisterSource(conf.NewFlagWithArgs(x, strings.Fields(buf.String())))
+	x.Parse()
+	assert.Equal(t, &TestExportSliceStruct{List: []string{"a", "b"}, Ports: []int{80, 443}}, s2)
+}
+
+// 测试 同步已有 yaml 文件, 补充缺少的参数, 保留已有的值和注释, 报告未知的参数
+func TestYamlSync(t *testing.T) {
+	var filepath = "test/test_sync.yaml"
+	assert.Nil(t, os.WriteFile(filepath, []byte("t:\n  # my name\n  name: custom\n  old: 1\nyaml:\n  filepath: test/test_sync.yaml\n  profile: \"\"\n"), os.ModePerm))
+	var x = conf.New()
+	flag := conf.NewFlagWithArgs(x, []string{"-yaml_filepath=" + filepath})
+	y := conf.NewYaml(x)
+	s := &TestYamlGenerateStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterConfWithName("yaml", y.YamlConf)
+	x.RegisterSource(flag)
+	x.RegisterSource(y)
+	x.Parse()
+
+	buf := &bytes.Buffer{}
+	result, err := y.SyncDryRun(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"t.port: 8080", "t.debug: false", "t.rate: 0.5", "t.count: 0"}, result.Added)
+	assert.Equal(t, []string{"t.old"}, result.Unknown)
+	assert.Equal(t, "+ t.port: 8080\n+ t.debug: false\n+ t.rate: 0.5\n+ t.count: 0\n? t.old (unknown key)\n", buf.String())
+
+	_, err = y.Sync()
+	assert.Nil(t, err)
+	content, err := os.ReadFile(filepath)
+	assert.Nil(t, err)
+	assert.Equal(t, "t:\n  # my name\n  name: custom\n  old: 1\n  # listen port\n  port: 8080\n  debug: false\n  rate: 0.5\n  count: 0\nyaml:\n  filepath: test/test_sync.yaml\n  profile: \"\"\n", string(content))
+}
+
+// 测试 严格模式下报告 yaml 中未注册的参数, 包括位置和建议的参数
+func TestStrict(t *testing.T) {
+	var filepath = "test/test_strict.yaml"
+	assert.Nil(t, os.WriteFile(filepath, []byte("t:\n  struct:\n    name: yaml-name\n  strcut:\n    name: typo\n"), os.ModePerm))
+	for _, mode := range []conf.StrictMode{conf.StrictError, conf.StrictWarn} {
+		var results []*conf.ParseResult
+		var x = conf.New(conf.WithStrict(mode), conf.WithResultHandler(func(result *conf.ParseResult) {
+			results = append(results, result)
+		}))
+		flag := conf.NewFlagWithArgs(x, []string{"-yaml_filepath=" + filepath})
+		y := conf.NewYaml(x)
+		s := &TestYamlStruct{}
+		x.RegisterConfWithName("t", s)
+		x.RegisterConfWithName("yaml", y.YamlConf)
+		x.RegisterSource(flag)
+		x.RegisterSource(y)
+		x.Parse()
+		assert.Equal(t, "yaml-name", s.TestYamlNest.Name)
+		assert.Len(t, results, 1)
+		message := "unknown key t_strcut_name from yaml (test/test_strict.yaml:5), did you mean t_struct_name?"
+		if mode == conf.StrictError {
+			assert.ErrorIs(t, results[0].Err, conf.ErrUnknownKey)
+			assert.Contains(t, results[0].Err.Error(), message)
+		} else {
+			assert.Nil(t, results[0].Err)
+			assert.Equal(t, []string{message}, results[0].Warnings)
+		}
+	}
+}
+
+type TestCommandGlobal struct {
+	Verbose bool `conf:"verbose"`
+}
+
+type TestServeStruct struct {
+	Port int `conf:"port,default=80,usage=listen port"`
+}
+
+type TestMigrateStruct struct {
+	Steps int `conf:"steps"`
+}
+
+// 测试 子命令, 只注册选中的子命令的结构体, 并保留剩余的位置参数
+func TestCommand(t *testing.T) {
+	var x = conf.New()
+	flag := conf.NewFlagWithArgs(x, []string{"-g_verbose", "serve", "-test_serve_struct_port=8080", "extra", "-x"})
+	g := &TestCommandGlobal{}
+	serve := &TestServeStruct{}
+	migrate := &TestMigrateStruct{}
+	x.RegisterConfWithName("g", g)
+	x.RegisterCommand("serve", serve)
+	x.RegisterCommand("migrate", migrate)
+	x.RegisterSource(flag)
+	x.Parse()
+	assert.Equal(t, "serve", x.Command())
+	assert.Equal(t, []string{"extra", "-x"}, x.CommandArgs())
+	assert.Equal(t, true, g.Verbose)
+	assert.Equal(t, 8080, serve.Port)
+	_, has := x.Get("test_migrate_struct_steps")
+	assert.False(t, has)
+
+	buf := &bytes.Buffer{}
+	x.PrintUsage(buf)
+	assert.Equal(t, "Usage of serve:\n  -g_verbose, -no-g_verbose\n  -test_serve_struct_port\n    \tlisten port (default 80)\n", buf.String())
+	buf.Reset()
+	assert.Nil(t, x.CommandUsage("migrate", buf))
+	assert.Equal(t, "Usage of migrate:\n  -test_migrate_struct_steps\n", buf.String())
+
+	// 子命令在所有配置源之前选中, 先注册的配置源也可以设置子命令的参数
+	x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {
+		assert.Nil(t, result.Err)
+	}))
+	serve = &TestServeStruct{}
+	x.RegisterConfWithName("g", &TestCommandGlobal{})
+	x.RegisterCommand("serve", serve)
+	x.RegisterSource(conf.NewYamlWithBytes(x, []byte("test_serve_struct:\n  port: 9090\n")))
+	x.RegisterSource(conf.NewFlagWithArgs(x, []string{"-g_verbose", "serve"}))
+	assert.Nil(t, x.Parse())
+	assert.Equal(t, "serve", x.Command())
+	assert.Equal(t, 9090, serve.Port)
+
+	// 未知的子命令通过 handler 返回错误, 不会 panic
+	x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {}))
+	x.RegisterCommand("serve", &TestServeStruct{})
+	x.RegisterSource(conf.NewFlagWithArgs(x, []string{"srve"}))
+	err := x.Parse()
+	assert.ErrorIs(t, err, conf.ErrUnknownCommand)
+	assert.ErrorIs(t, err, conf.ErrFlagParse)
+}
+
+// 测试 -h 输出帮助信息并通过 handler 返回 ErrHelp
+func TestCommandHelp(t *testing.T) {
+	var parseErr error
+	var x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {
+		parseErr = result.Err
+	}))
+	flag := conf.NewFlagWithArgs(x, []string{"-h"})
+	x.RegisterConfWithName("g", &TestCommandGlobal{})
+	x.RegisterCommand("serve", &TestServeStruct{})
+	x.RegisterSource(flag)
+	x.Parse()
+	assert.ErrorIs(t, parseErr, conf.ErrHelp)
+	assert.Equal(t, "", x.Command())
+
+	// 默认的 handler 不退出, Parse 返回 ErrHelp, 之后的配置源和校验不再执行
+	x = conf.New()
+	x.RegisterConfWithName("t", &TestDocsStruct{})
+	x.RegisterSource(conf.NewFlagWithArgs(x, []string{"-help"}))
+	assert.ErrorIs(t, x.Parse(), conf.ErrHelp)
+}
+
+type TestPositionalStruct struct {
+	Src   string   `conf:"src,pos=0"`
+	Files []string `conf:"files,pos=1"`
+	Tags  []string `conf:"tags,default=a|b"`
+	Ports []int    `conf:"ports"`
+}
+
+// 测试 位置参数以及 -- 之后的参数, 绑定到 pos 标签的字段, 以及标量切片
+func TestPositional(t *testing.T) {
+	var x = conf.New()
+	flag := conf.NewFlagWithArgs(x, []string{"-t_ports=80,443", "--", "-src", "f1", "f2"})
+	s := &TestPositionalStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(flag)
+	x.Parse()
+	assert.Equal(t, []string{"-src", "f1", "f2"}, flag.Args())
+	assert.Equal(t, 3, flag.NArg())
+	assert.Equal(t, "f1", flag.Arg(1))
+	assert.Equal(t, "", flag.Arg(3))
+	assert.Equal(t, "-src", s.Src)
+	assert.Equal(t, []string{"f1", "f2"}, s.Files)
+	assert.Equal(t, []string{"a", "b"}, s.Tags)
+	assert.Equal(t, []int{80, 443}, s.Ports)
+}
+
+// 测试 指定参数和环境变量, 多个实例可以并行解析互不影响
+func TestInjectArgsEnv(t *testing.T) {
+	for _, profile := range []string{"prod", "dev"} {
+		profile := profile
+		t.Run(profile, func(t *testing.T) {
+			t.Parallel()
+			var profiles []string
+			var x = conf.New(
+				conf.WithEnviron([]string{conf.ProfileEnv + "=" + profile}),
+				conf.WithResultHandler(func(result *conf.ParseResult) {
+					profiles = result.Profiles
+				}),
+			)
+			flag := conf.NewFlagWithArgs(x, []string{"-t_string=" + profile})
+			s := &TestFlagTypeStruct{}
+			x.RegisterConfWithName("t", s)
+			x.RegisterSource(flag)
+			x.Parse()
+			x.PrintResult()
+			assert.Equal(t, profile, s.String)
+			assert.Equal(t, []string{profile}, profiles)
+		})
+	}
+}
+
+// 测试 布尔参数支持的格式以及 --no-<key> 取反
+func TestFlagBool(t *testing.T) {
+	var x = conf.New()
+	flag := conf.NewFlagWithArgs(x, []string{"-t_string=1", "-t_int=1", "-t_bool=YES", "--no-t_bool_default"})
+	s := &TestFlagTypeStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(flag)
+	x.Parse()
+	assert.Equal(t, true, s.Bool)
+	assert.Equal(t, false, s.BoolDefault)
+
+	for str, expect := range map[string]bool{"1": true, "t": true, "TRUE": true, "on": true, "y": true, "0": false, "F": false, "off": false, "No": false} {
+		err := x.Set("t_bool", str)
+		assert.Nil(t, err)
+		assert.Equal(t, expect, s.Bool, str)
+	}
+	assert.ErrorIs(t, x.Set("t_bool", "maybe"), conf.ErrInvalidValue)
+}
+
+type TestNumberStruct struct {
+	Int8    int8    `conf:"int8"`
+	Int     int     `conf:"int"`
+	Uint8   uint8   `conf:"uint8"`
+	Uint    uint    `conf:"uint"`
+	Float32 float32 `conf:"float32"`
+	Float   float64 `conf:"float"`
+}
+
+// 测试 数值解析, 包括进制前缀, 分隔符, 溢出检查以及不同数值类型之间的精确转换
+func TestNumber(t *testing.T) {
+	var x = conf.New()
+	s := &TestNumberStruct{}
+	x.RegisterConfWithName("t", s)
+	x.Parse()
+
+	for _, c := range []struct {
+		key    string
+		value  interface{}
+		expect interface{}
+		err    error
+	}{
+		{"t_int8", "0x7f", int8(127), nil},
+		{"t_int8", "-0b1000_0000", int8(-128), nil},
+		{"t_int8", "128", nil, conf.ErrValueOutOfRange},
+		{"t_int8", 300, nil, conf.ErrValueOutOfRange},
+		{"t_int", "1_000_000", 1000000, nil},
+		{"t_int", "0o17", 15, nil},
+		{"t_int", "010", 10, nil},
+		{"t_int", "-0_10", -10, nil},
+		{"t_int", "1__0", nil, conf.ErrInvalidValue},
+		{"t_int", float64(42), 42, nil},
+		{"t_int", 4.2, nil, conf.ErrInvalidValue},
+		{"t_int", uint64(1 << 63), nil, conf.ErrValueOutOfRange},
+		{"t_int", "abc", nil, conf.ErrInvalidValue},
+		{"t_uint8", 255, uint8(255), nil},
+		{"t_uint8", 256, nil, conf.ErrValueOutOfRange},
+		{"t_uint", "-1", nil, conf.ErrValueOutOfRange},
+		{"t_uint", -1, nil, conf.ErrValueOutOfRange},
+		{"t_uint", 8080, uint(8080), nil},
+		{"t_uint", "0xFF", uint(255), nil},
+		{"t_uint", "08080", uint(8080), nil},
+		{"t_float", 3, float64(3), nil},
+		{"t_float", "1_000.5", 1000.5, nil},
+		{"t_float32", "1e40", nil, conf.ErrValueOutOfRange},
+		{"t_float", int64(1<<53 + 1), nil, conf.ErrInvalidValue},
+	} {
+		err := x.Set(c.key, c.value)
+		if c.err != nil {
+			assert.ErrorIs(t, err, c.err, "%s=%v", c.key, c.value)
+			assert.Contains(t, err.Error(), c.key)
+			continue
+		}
+		assert.Nil(t, err, "%s=%v", c.key, c.value)
+		switch c.key {
+		case "t_int8":
+			assert.Equal(t, c.expect, s.Int8)
+		case "t_int":
+			assert.Equal(t, c.expect, s.Int)
+		case "t_uint8":
+			assert.Equal(t, c.expect, s.Uint8)
+		case "t_uint":
+			assert.Equal(t, c.expect, s.Uint)
+		case "t_float":
+			assert.Equal(t, c.expect, s.Float)
+		}
+	}
+}
+
+type TestUnitStruct struct {
+	Buffer conf.ByteSize `conf:"buffer,default=512MiB"`
+	Cache  conf.ByteSize `conf:"cache"`
+	Ratio  conf.Percent  `conf:"ratio,default=75%"`
+}
+
+// 测试 字节大小和百分比的解析和输出
+func TestUnit(t *testing.T) {
+	var x = conf.New()
+	flag := conf.NewFlagWithArgs(x, []string{"-t_cache=1.5GB"})
+	s := &TestUnitStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(flag)
+	x.Parse()
+	assert.Equal(t, 512*conf.MiB, s.Buffer)
+	assert.Equal(t, conf.ByteSize(1500000000), s.Cache)
+	assert.Equal(t, conf.Percent(0.75), s.Ratio)
+
+	assert.Nil(t, x.Set("t_ratio", "12.5%"))
+	assert.Equal(t, conf.Percent(0.125), s.Ratio)
+	assert.Nil(t, x.Set("t_buffer", 2048))
+	assert.Equal(t, 2*conf.KiB, s.Buffer)
+	assert.ErrorIs(t, x.Set("t_buffer", "12XB"), conf.ErrInvalidValue)
+	assert.ErrorIs(t, x.Set("t_buffer", "0.5B"), conf.ErrInvalidValue)
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, x.Export(buf, conf.ExportYaml))
+	assert.Equal(t, "t:\n  buffer: 2KiB\n  cache: 1500MB\n  ratio: 12.5%\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, conf.NewYaml(x).Generate(buf))
+	assert.Equal(t, "t:\n  buffer: 512MiB\n  cache: 0B\n  ratio: 75%\n", buf.String())
+}
+
+type TestUpstreamStruct struct {
+	Upstreams []TestUpstream `conf:"upstreams,usage=upstream servers"`
+}
+
+type TestUpstream struct {
+	Host   string `conf:"host,default=localhost"`
+	Port   int    `conf:"port,default=80"`
+	Weight int    `conf:"weight,default=1"`
+}
+
+// 测试 yaml 中元素为 map 的切片, 每个元素应用默认值, 并且可以通过下标覆盖单个元素的字段
+func TestStructSlice(t *testing.T) {
+	var filepath = "test/test_struct_slice.yaml"
+	assert.Nil(t, os.WriteFile(filepath, []byte("t:\n  upstreams:\n    - host: a.example.com\n      port: 8080\n    - host: b.example.com\n      weight: 5\n"), os.ModePerm))
+	var x = conf.New()
+	flag := conf.NewFlagWithArgs(x, []string{"-yaml_filepath=" + filepath, "-t_upstreams_0_port=9090"})
+	y := conf.NewYaml(x)
+	s := &TestUpstreamStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterConfWithName("yaml", y.YamlConf)
+	x.RegisterSource(flag)
+	x.RegisterSource(y)
+	x.Parse()
+	assert.Equal(t, []TestUpstream{
+		{Host: "a.example.com", Port: 9090, Weight: 1},
+		{Host: "b.example.com", Port: 80, Weight: 5},
+	}, s.Upstreams)
+	v, has := x.Get("t_upstreams_1_weight")
+	assert.True(t, has)
+	assert.Equal(t, int64(5), v)
+
+	assert.Nil(t, x.Set("t_upstreams_2_host", "c.example.com"))
+	assert.Len(t, s.Upstreams, 3)
+	assert.Equal(t, TestUpstream{Host: "c.example.com", Port: 80, Weight: 1}, s.Upstreams[2])
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, x.Export(buf, conf.ExportYaml))
+	assert.Contains(t, buf.String(), "t:\n  # upstream servers\n  upstreams:\n    - host: a.example.com\n      port: 9090\n      weight: 1\n    - host: b.example.com\n")
+
+	buf.Reset()
+	assert.Nil(t, y.Generate(buf))
+	assert.Contains(t, buf.String(), "t:\n  # upstream servers\n  upstreams:\n    - host: localhost\n      port: 80\n      weight: 1\n")
+
+	// 整体替换切片
+	assert.Nil(t, x.Set("t_upstreams", []interface{}{map[string]interface{}{"host": "d.example.com"}}))
+	assert.Equal(t, []TestUpstream{{Host: "d.example.com", Port: 80, Weight: 1}}, s.Upstreams)
+	_, has = x.Get("t_upstreams_1_host")
+	assert.False(t, has)
+	// 下标最多为当前的长度
+	assert.ErrorIs(t, x.Set("t_upstreams_5_host", "e.example.com"), conf.ErrStructSliceIndex)
+	assert.Len(t, s.Upstreams, 1)
+	// 元素中不存在的字段不会创建元素
+	_, has = x.Get("t_upstreams_1_hots")
+	assert.False(t, has)
+	assert.Len(t, s.Upstreams, 1)
+
+	// 跳过的下标作为错误报告
+	var parseErr error
+	x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {
+		if result.Err != nil {
+			parseErr = result.Err
+		}
+	}))
+	flag = conf.NewFlagWithArgs(x, []string{"-t_upstreams_2_host=c.example.com"})
+	x.RegisterConfWithName("t", &TestUpstreamStruct{})
+	x.RegisterSource(flag)
+	x.Parse()
+	assert.ErrorIs(t, parseErr, conf.ErrStructSliceIndex)
+	assert.Contains(t, parseErr.Error(), "t_upstreams_0,t_upstreams_1")
+
+	// 严格模式下报告元素中未注册的字段
+	x = conf.New(conf.WithStrict(conf.StrictError))
+	x.RegisterConfWithName("t", &TestUpstreamStruct{})
+	x.Parse()
+	err := x.Set("t_upstreams", []interface{}{map[string]interface{}{"host": "a.example.com", "prot": 80}})
+	assert.ErrorIs(t, err, conf.ErrUnknownKey)
+	assert.Contains(t, err.Error(), "t_upstreams_0_prot")
+
+	// 警告模式下元素中未注册的字段记录实际的配置源, 不同配置源中相同的参数分别报告
+	var warnings []string
+	x = conf.New(conf.WithStrict(conf.StrictWarn), conf.WithResultHandler(func(result *conf.ParseResult) {
+		warnings = append(warnings, result.Warnings...)
+	}))
+	x.RegisterConfWithName("t", &TestUpstreamStruct{})
+	x.RegisterSource(conf.NewYamlWithBytes(x, []byte("t:\n  upstreams:\n    - prot: 80\n")))
+	x.RegisterSource(&TestProbeSource{values: map[string]interface{}{
+		"t_upstreams": []interface{}{map[string]interface{}{"host": "a.example.com", "prot": 81}},
+	}})
+	x.Parse()
+	assert.Equal(t, []string{
+		"unknown key t_upstreams_0_prot from yaml (-:3), did you mean t_upstreams_0_port?",
+		"unknown key t_upstreams_0_prot from *conf_test.TestProbeSource, did you mean t_upstreams_0_port?",
+	}, warnings)
+}
+
+type TestPluginStruct struct {
+	Size conf.ByteSize `conf:"size"`
+	TTL  int           `conf:"ttl,default=60"`
+	Mode string        `conf:"mode,default=lru"`
+}
+
+// 测试 Parse 之后将没有注册的前缀解析到结构体中, 并应用默认值
+func TestUnmarshalKey(t *testing.T) {
+	var filepath = "test/test_unmarshal.yaml"
+	assert.Nil(t, os.WriteFile(filepath, []byte("plugins:\n  cache:\n    size: 10MiB\n    mode: lfu\n  bad:\n    ttl: abc\n"), os.ModePerm))
+	var x = conf.New()
+	flag := conf.NewFlagWithArgs(x, []string{"-yaml_filepath=" + filepath})
+	y := conf.NewYaml(x)
+	x.RegisterConfWithName("yaml", y.YamlConf)
+	x.RegisterSource(flag)
+	x.RegisterSource(y)
+	x.Parse()
+
+	p := &TestPluginStruct{}
+	assert.Nil(t, x.UnmarshalKey("plugins_cache", p))
+	assert.Equal(t, TestPluginStruct{Size: 10 * conf.MiB, TTL: 60, Mode: "lfu"}, *p)
+
+	p = &TestPluginStruct{}
+	assert.Nil(t, x.Sub("plugins").Sub("cache").Unmarshal(p))
+	assert.Equal(t, "lfu", p.Mode)
+
+	err := x.UnmarshalKey("plugins_bad", &TestPluginStruct{})
+	assert.ErrorIs(t, err, conf.ErrUnmarshal)
+	assert.ErrorIs(t, err, conf.ErrInvalidValue)
+	assert.Contains(t, err.Error(), "plugins_bad_ttl")
+
+	assert.ErrorIs(t, x.UnmarshalKey("plugins_cache", TestPluginStruct{}), conf.ErrRegisterConfigNotPtr)
+}
+
+// 测试 泛型获取参数的值, 区分参数不存在和类型不匹配
+func TestGetAs(t *testing.T) {
+	var x = conf.New()
+	flag := conf.NewFlagWithArgs(x, []string{"-t_int=300", "-t_uint8=7", "-t_float=2.5"})
+	s := &TestNumberStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(flag)
+	x.Parse()
+
+	i, err := conf.GetAs[int](x, "t_int")
+	assert.Nil(t, err)
+	assert.Equal(t, 300, i)
+	i64, err := conf.GetAs[int64](x, "t_uint8")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), i64)
+	f, err := conf.GetAs[float32](x, "t_float")
+	assert.Nil(t, err)
+	assert.Equal(t, float32(2.5), f)
+
+	_, err = conf.GetAs[int8](x, "t_int")
+	assert.ErrorIs(t, err, conf.ErrTypeMismatch)
+	assert.ErrorIs(t, err, conf.ErrValueOutOfRange)
+	_, err = conf.GetAs[int](x, "t_float")
+	assert.ErrorIs(t, err, conf.ErrTypeMismatch)
+	_, err = conf.GetAs[string](x, "t_int")
+	assert.ErrorIs(t, err, conf.ErrTypeMismatch)
+	_, err = conf.GetAs[int](x, "t_missing")
+	assert.ErrorIs(t, err, conf.ErrKeyNotFound)
+
+	assert.Equal(t, uint(7), conf.MustGet[uint](x, "t_uint8"))
+	assert.Equal(t, 10, conf.GetOr(x, "t_missing", 10))
+	assert.Panics(t, func() { conf.MustGet[bool](x, "t_int") })
+
+	var u = conf.New()
+	us := &TestUnitStruct{}
+	u.RegisterConfWithName("t", us)
+	u.Parse()
+	size, err := conf.GetAs[conf.ByteSize](u, "t_buffer")
+	assert.Nil(t, err)
+	assert.Equal(t, 512*conf.MiB, size)
+	str, err := conf.GetAs[string](u, "t_buffer")
+	assert.Nil(t, err)
+	assert.Equal(t, "512MiB", str)
+}
+
+// 测试 Set 标记参数来源, 严格模式下拒绝未知参数, SetMany 失败时全部恢复, 成功时只通知一次
+func TestSetMany(t *testing.T) {
+	var filepath = "test/test_set_many.yaml"
+	assert.Nil(t, os.WriteFile(filepath, []byte("t:\n  int: 5\n  float32: 2\n"), os.ModePerm))
+	var configs []conf.ConfigResult
+	var x = conf.New(conf.WithStrict(conf.StrictError), conf.WithResultHandler(func(result *conf.ParseResult) {
+		assert.Nil(t, result.Err)
+		configs = result.Configs()
+	}))
+	flag := conf.NewFlagWithArgs(x, []string{"-yaml_filepath=" + filepath, "-t_uint=1"})
+	y := conf.NewYaml(x)
+	s := &TestNumberStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterConfWithName("yaml", y.YamlConf)
+	x.RegisterSource(flag)
+	x.RegisterSource(y)
+	x.Parse()
+
+	var changes [][]string
+	x.OnChange(func(keys []string) {
+		changes = append(changes, keys)
+	})
+	assert.ErrorIs(t, x.Set("t_unknown", 1), conf.ErrUnknownKey)
+	assert.Nil(t, x.Set("t_int8", 8))
+
+	err := x.SetMany(map[string]interface{}{"t_int": 6, "t_float": 1.5, "t_uint8": 1000})
+	assert.ErrorIs(t, err, conf.ErrValueOutOfRange)
+	assert.Equal(t, 5, s.Int)
+	assert.Equal(t, float64(0), s.Float)
+
+	err = x.SetMany(map[string]interface{}{"t_int": 6, "t_float": 1.5})
+	assert.Nil(t, err)
+	assert.Equal(t, 6, s.Int)
+	assert.Equal(t, 1.5, s.Float)
+	assert.Equal(t, [][]string{{"t_int8"}, {"t_float", "t_int"}}, changes)
+
+	x.PrintResult()
+	origins := map[string]string{}
+	for _, config := range configs {
+		origins[config.Key] = config.Origin
+	}
+	assert.Equal(t, "flag", origins["t_uint"])
+	assert.Equal(t, "set", origins["t_int"])
+	assert.Equal(t, "", origins["t_uint8"])
+	assert.Equal(t, "yaml (test/test_set_many.yaml:3)", origins["t_float32"])
+
+	// 所有的值校验通过之前不修改任何参数, 结构体切片的元素和来源保持不变
+	filepath = "test/test_set_many_slice.yaml"
+	assert.Nil(t, os.WriteFile(filepath, []byte("t:\n  upstreams:\n    - host: a.example.com\n    - host: b.example.com\n"), os.ModePerm))
+	x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {
+		assert.Nil(t, result.Err)
+		configs = result.Configs()
+	}))
+	y = conf.NewYaml(x)
+	y.YamlConf.FilePath = filepath
+	upstreams := &TestUpstreamStruct{}
+	x.RegisterConfWithName("t", upstreams)
+	x.RegisterSource(y)
+	x.Parse()
+	changes = nil
+	x.OnChange(func(keys []string) {
+		changes = append(changes, keys)
+	})
+	err = x.SetMany(map[string]interface{}{
+		"t_upstreams":        []interface{}{map[string]interface{}{"host": "c.example.com"}},
+		"t_upstreams_0_port": "abc",
+	})
+	assert.ErrorIs(t, err, conf.ErrArgSetValue)
+	err = x.SetMany(map[string]interface{}{"t_upstreams_2_host": "c.example.com", "t_upstreams_2_port": "abc"})
+	assert.ErrorIs(t, err, conf.ErrArgSetValue)
+	assert.Nil(t, changes)
+	assert.Equal(t, []TestUpstream{
+		{Host: "a.example.com", Port: 80, Weight: 1},
+		{Host: "b.example.com", Port: 80, Weight: 1},
+	}, upstreams.Upstreams)
+	x.PrintResult()
+	origins = map[string]string{}
+	for _, config := range configs {
+		origins[config.Key] = config.Origin
+	}
+	assert.Equal(t, "yaml ("+filepath+":3)", origins["t_upstreams_0_host"])
+
+	assert.Nil(t, x.SetMany(map[string]interface{}{"t_upstreams_2_host": "c.example.com", "t_upstreams_3_port": 8080}))
+	assert.Len(t, upstreams.Upstreams, 4)
+	assert.Equal(t, TestUpstream{Host: "localhost", Port: 8080, Weight: 1}, upstreams.Upstreams[3])
+}
+
+type TestSchemaStruct struct {
+	Name      string         `conf:"name,required=true,min=1,max=32,usage=service name"`
+	Mode      string         `conf:"mode,default=fast,enum=fast|safe"`
+	Port      int            `conf:"port,default=8080,min=1,max=65535"`
+	Workers   uint           `conf:"workers"`
+	Tags      []string       `conf:"tags,max=3"`
+	Buffer    conf.ByteSize  `conf:"buffer,default=1MiB"`
+	Upstreams []TestUpstream `conf:"upstreams"`
+	Level     string         `conf:"level,enum=debug|info,min=4"`
+}
+
+// 测试 标签中的校验规则, 以及生成 JSON Schema
+func TestSchema(t *testing.T) {
+	var parseErr error
+	var x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {
+		parseErr = result.Err
+	}))
+	flag := conf.NewFlagWithArgs(x, []string{"-t_mode=slow", "-t_port=0", "-t_tags=a,b,c,d"})
+	s := &TestSchemaStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(flag)
+	x.Parse()
+	assert.ErrorIs(t, parseErr, conf.ErrValidate)
+	assert.Contains(t, parseErr.Error(), "t_name is required")
+	assert.Contains(t, parseErr.Error(), "t_mode value slow not in [fast safe]")
+	assert.Contains(t, parseErr.Error(), "t_port value 0 less than min 1")
+	assert.Contains(t, parseErr.Error(), "t_tags length 4 greater than max 3")
+	// 没有设置也没有默认值的可选参数不校验 enum, min, max
+	assert.NotContains(t, parseErr.Error(), "t_level")
+
+	assert.Nil(t, x.SetMany(map[string]interface{}{"t_name": "app", "t_mode": "safe", "t_port": 80, "t_tags": "a"}))
+	assert.Nil(t, x.Validate())
+	// 设置之后同样校验
+	assert.ErrorIs(t, x.Set("t_level", ""), conf.ErrValidate)
+
+	schema, err := x.JSONSchema()
+	assert.Nil(t, err)
+	var doc map[string]interface{}
+	assert.Nil(t, json.Unmarshal(schema, &doc))
+	assert.Equal(t, "https://json-schema.org/draft/2020-12/schema", doc["$schema"])
+	props := doc["properties"].(map[string]interface{})["t"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"name"}, props["required"])
+	fields := props["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "string", "description": "service name", "minLength": float64(1), "maxLength": float64(32)}, fields["name"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "default": "fast", "enum": []interface{}{"fast", "safe"}}, fields["mode"])
+	assert.Equal(t, map[string]interface{}{"type": "integer", "default": float64(8080), "minimum": float64(1), "maximum": float64(65535)}, fields["port"])
+	assert.Equal(t, map[string]interface{}{"type": "integer", "minimum": float64(0)}, fields["workers"])
+	assert.Equal(t, map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "maxItems": float64(3)}, fields["tags"])
+	assert.Equal(t, map[string]interface{}{"type": []interface{}{"string", "integer"}, "format": "byte-size", "default": "1MiB"}, fields["buffer"])
+	upstreams := fields["upstreams"].(map[string]interface{})
+	assert.Equal(t, "array", upstreams["type"])
+	assert.Equal(t, map[string]interface{}{"type": "integer", "default": float64(80)}, upstreams["items"].(map[string]interface{})["properties"].(map[string]interface{})["port"])
+	// 保持字段顺序
+	assert.Less(t, bytes.Index(schema, []byte(`"name"`)), bytes.Index(schema, []byte(`"mode"`)))
+}
+
+type TestDocsStruct struct {
+	Name      string         `conf:"name,required=true,usage=service name"`
+	Debug     bool           `conf:"debug"`
+	Password  string         `conf:"password,default=123,secret=true"`
+	Tags      []string       `conf:"tags,default=a|b,usage=a|b list"`
+	Upstreams []TestUpstream `conf:"upstreams,usage=upstream servers"`
+}
+
+// 测试 生成 Markdown 和 HTML 格式的配置说明文档
+func TestWriteDocs(t *testing.T) {
+	var x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {}))
+	x.RegisterConfWithName("t", &TestDocsStruct{})
+	x.Parse()
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, x.WriteDocs(buf, conf.DocsMarkdown))
+	assert.Equal(t, "| Key | Flag | Env | YAML | Type | Default | Required | Description |\n"+
+		"| --- | --- | --- | --- | --- | --- | --- | --- |\n"+
+		"| `t_name` | `-t_name` | `T_NAME` | `t.name` | `string` |  | yes | service name |\n"+
+		"| `t_debug` | `-t_debug, -no-t_debug` | `T_DEBUG` | `t.debug` | `bool` |  |  |  |\n"+
+		"| `t_password` | `-t_password` | `T_PASSWORD` | `t.password` | `string` | `******` |  |  |\n"+
+		"| `t_tags` | `-t_tags` | `T_TAGS` | `t.tags` | `[]string` | `a,b` |  | a\\|b list |\n"+
+		"| `t_upstreams` | `-t_upstreams` | `T_UPSTREAMS` | `t.upstreams` | `[]object` |  |  | upstream servers |\n"+
+		"| `t_upstreams_<i>_host` | `-t_upstreams_<i>_host` | `T_UPSTREAMS_<i>_HOST` | `t.upstreams[].host` | `string` | `localhost` |  |  |\n"+
+		"| `t_upstreams_<i>_port` | `-t_upstreams_<i>_port` | `T_UPSTREAMS_<i>_PORT` | `t.upstreams[].port` | `int` | `80` |  |  |\n"+
+		"| `t_upstreams_<i>_weight` | `-t_upstreams_<i>_weight` | `T_UPSTREAMS_<i>_WEIGHT` | `t.upstreams[].weight` | `int` | `1` |  |  |\n",
+		buf.String())
+
+	buf.Reset()
+	assert.Nil(t, x.WriteDocs(buf, conf.DocsHtml))
+	assert.Contains(t, buf.String(), "<th>Key</th><th>Flag</th>")
+	assert.Contains(t, buf.String(), "<td><code>t_upstreams_&lt;i&gt;_host</code></td>")
+
+	assert.ErrorIs(t, x.WriteDocs(buf, "pdf"), conf.ErrDocsFormat)
+}
+
+type TestDiffStruct struct {
+	Host     string   `conf:"host,default=localhost"`
+	Port     int      `conf:"port,default=80"`
+	Password string   `conf:"password,secret=true"`
+	Tags     []string `conf:"tags"`
+}
+
+type TestDiffExtraStruct struct {
+	Debug bool `conf:"debug"`
+}
+
+// 测试 比较两份配置的差异, 敏感信息按照实际的值比较, 输出时隐藏
+func TestDiff(t *testing.T) {
+	newX := func(args []string, extra bool) *conf.X {
+		x := conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {}))
+		x.RegisterConfWithName("t", &TestDiffStruct{})
+		if extra {
+			x.RegisterConfWithName("e", &TestDiffExtraStruct{})
+		}
+		x.RegisterSource(conf.NewFlagWithArgs(x, args))
+		x.Parse()
+		return x
+	}
+	running := newX([]string{"-t_password=old", "-t_tags=a,b"}, true)
+	candidate := newX([]string{"-t_port=8080", "-t_password=new", "-t_tags=a,b"}, false)
+	diffs := running.Diff(candidate)
+	assert.Equal(t, []conf.ConfigDiff{
+		{Key: "t_port", Kind: conf.DiffChanged, Old: int64(80), OldOrigin: "default", New: int64(8080), NewOrigin: "flag"},
+		{Key: "t_password", Kind: conf.DiffChanged, Old: "******", OldOrigin: "flag", New: "******", NewOrigin: "flag"},
+		{Key: "e_debug", Kind: conf.DiffRemoved, Old: false},
+	}, diffs)
+	assert.Equal(t, "~ t_port: 80 -> 8080 [default -> flag]\n"+
+		"~ t_password: ****** -> ****** [flag -> flag]\n"+
+		"- e_debug: false\n", conf.DiffText(diffs))
+	assert.Empty(t, running.Diff(running))
+
+	data, err := json.Marshal(candidate.Diff(running)[2])
+	assert.Nil(t, err)
+	assert.Equal(t, `{"key":"e_debug","kind":"added","new":false}`, string(data))
+
+	// 通过 handler 输出
+	var printed []conf.ConfigDiff
+	x := conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {
+		printed = result.Diffs()
+	}))
+	x.RegisterConfWithName("t", &TestDiffStruct{})
+	x.Parse()
+	x.PrintDiff(candidate)
+	assert.Equal(t, []string{"t_port", "t_password"}, []string{printed[0].Key, printed[1].Key})
+}
+
+type TestHandlerStruct struct {
+	Host     string `conf:"host,default=localhost,usage=listen host"`
+	Port     int    `conf:"port,default=80,min=1,max=65535"`
+	Password string `conf:"password,default=123,secret=true"`
+}
+
+// 测试 通过 http 输出和修改配置
+func TestHandler(t *testing.T) {
+	var x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {}), conf.WithProfile("dev"))
+	x.RegisterConfWithName("t", &TestHandlerStruct{})
+	x.Parse()
+	var changed []string
+	x.OnChange(func(keys []string) {
+		changed = keys
+		// 通知时已经释放锁
+		_ = x.Stats()
+	})
+	server := httptest.NewServer(conf.Handler(x, conf.WithHandlerToken("token")))
+	defer server.Close()
+
+	get := func(query string, accept string) (string, string) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+query, nil)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.Header.Get("Content-Type"), string(body)
+	}
+	put := func(body string, token string) (int, string) {
+		req, _ := http.NewRequest(http.MethodPut, server.URL, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	contentType, body := get("", "")
+	assert.Equal(t, "application/json; charset=utf-8", contentType)
+	var result conf.HandlerResult
+	assert.Nil(t, json.Unmarshal([]byte(body), &result))
+	assert.Equal(t, []string{"dev"}, result.Profiles)
+	assert.Equal(t, conf.ConfigResult{Key: "t_host", Value: "localhost", Default: "localhost", Usage: "listen host", Origin: "default"}, result.Configs[0])
+	assert.Equal(t, "******", result.Configs[2].Value)
+	// 敏感信息的默认值同样隐藏
+	assert.Equal(t, "******", result.Configs[2].Default)
+	assert.NotContains(t, body, "123")
+
+	contentType, body = get("?prefix=t_port", "application/yaml")
+	assert.Equal(t, "application/yaml; charset=utf-8", contentType)
+	assert.Equal(t, "profiles:\n  - dev\nconfigs:\n  - key: t_port\n    value: 80\n    default: \"80\"\n    origin: default\n", body)
+
+	code, _ := put(`{"t_port": 8080}`, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, body = put(`{"t": {"port": 0, "host": "0.0.0.0"}}`, "token")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, body, "t_port value 0 less than min 1")
+	code, body = put(`{"t_prot": 8080}`, "token")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, body, "unknown key")
+	assert.Nil(t, changed)
+	host, _ := x.Get("t_host")
+	assert.Equal(t, "localhost", host)
+
+	code, body = put(`{"t": {"port": 8080, "host": "0.0.0.0"}}`, "token")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"origin": "set"`)
+	assert.Equal(t, []string{"t_host", "t_port"}, changed)
+	port, _ := conf.GetAs[int](x, "t_port")
+	assert.Equal(t, 8080, port)
+
+	// 没有开启 PUT
+	readonly := httptest.NewServer(conf.Handler(x))
+	defer readonly.Close()
+	req, _ := http.NewRequest(http.MethodPut, readonly.URL, strings.NewReader(`{}`))
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	resp.Body.Close()
+}
+
+type TestReloadStruct struct {
+	Host      string         `conf:"host,default=localhost"`
+	Port      int            `conf:"port,default=80,max=9999"`
+	Level     string         `conf:"level,default=info"`
+	Upstreams []TestUpstream `conf:"upstreams"`
+}
+
+type TestMetrics struct {
+	sources []string
+	reloads []error
+	// 设置时在 ObserveReload 中读取统计信息
+	x     *conf.X
+	stats []int64
+}
+
+func (m *TestMetrics) ObserveSourceParse(source string, duration time.Duration) {
+	m.sources = append(m.sources, source)
+}
+
+func (m *TestMetrics) ObserveReload(at time.Time, err error) {
+	m.reloads = append(m.reloads, err)
+	if m.x != nil {
+		m.stats = append(m.stats, m.x.Stats().Reloads)
+	}
+}
+
+// TestProbeSource 解析时调用 probe 的配置源
+type TestProbeSource struct {
+	values map[string]interface{}
+	probe  func()
+}
+
+func (p *TestProbeSource) Get(key string) (interface{}, bool) {
+	v, has := p.values[key]
+	return v, has
+}
+
+func (p *TestProbeSource) Parse() {
+	if p.probe != nil {
+		p.probe()
+	}
+}
+
+func (p *TestProbeSource) Range(f func(key string, value interface{}) bool) {
+	for key, value := range p.values {
+		if !f(key, value) {
+			return
+		}
+	}
+}
+
+// 测试 Reload 解析到参数的副本中, 注册的结构体只在成功后修改, handler 和 Metrics 在释放锁之后调用
+func TestReloadScratch(t *testing.T) {
+	var (
+		x     *conf.X
+		hosts []interface{}
+	)
+	metrics := &TestMetrics{}
+	x = conf.New(conf.WithStrict(conf.StrictWarn), conf.WithMetrics(metrics), conf.WithResultHandler(func(result *conf.ParseResult) {
+		// 未知参数的警告在 Reload 期间产生
+		host, _ := x.Get("t_host")
+		hosts = append(hosts, host)
+	}))
+	metrics.x = x
+	source := &TestProbeSource{values: map[string]interface{}{"t_host": "a", "t_upstreams_0_host": "u1", "t_unknown": 1}}
+	s := &TestReloadStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(source)
+	x.Parse()
+	assert.Equal(t, &TestReloadStruct{Host: "a", Port: 80, Level: "info", Upstreams: []TestUpstream{{Host: "u1", Port: 80, Weight: 1}}}, s)
+
+	var during []TestReloadStruct
+	source.probe = func() {
+		during = append(during, *s)
+	}
+	source.values = map[string]interface{}{"t_host": "b", "t_port": 10000, "t_unknown": 1}
+	assert.ErrorIs(t, x.Reload(), conf.ErrReload)
+	assert.Equal(t, &TestReloadStruct{Host: "a", Port: 80, Level: "info", Upstreams: []TestUpstream{{Host: "u1", Port: 80, Weight: 1}}}, s)
+	source.values = map[string]interface{}{"t_host": "c", "t_unknown": 1}
+	assert.Nil(t, x.Reload())
+	assert.Equal(t, &TestReloadStruct{Host: "c", Port: 80, Level: "info", Upstreams: []TestUpstream{}}, s)
+	// 解析期间结构体保持 Reload 之前的值
+	before := TestReloadStruct{Host: "a", Port: 80, Level: "info", Upstreams: []TestUpstream{{Host: "u1", Port: 80, Weight: 1}}}
+	assert.Equal(t, []TestReloadStruct{before, before}, during)
+	assert.Equal(t, []interface{}{"a", "a", "c"}, hosts)
+	assert.Equal(t, []int64{1, 2, 3}, metrics.stats)
+}
+
+// 测试 重新加载配置, 失败时恢复原来的值, 以及指标和 expvar
+func TestReload(t *testing.T) {
+	var filepath = "test/test_reload.yaml"
+	assert.Nil(t, os.WriteFile(filepath, []byte("t:\n  host: a.example.com\n  upstreams:\n    - host: u1\n    - host: u2\n"), os.ModePerm))
+	metrics := &TestMetrics{}
+	var x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {}), conf.WithMetrics(metrics))
+	flag := conf.NewFlagWithArgs(x, []string{"-t_level=debug"})
+	y := conf.NewYaml(x)
+	y.YamlConf.FilePath = filepath
+	s := &TestReloadStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(flag)
+	x.RegisterSource(y)
+	x.Parse()
+	assert.Equal(t, "a.example.com", s.Host)
+	assert.Equal(t, 2, len(s.Upstreams))
+	assert.Nil(t, x.Set("t_port", 8080))
+	var (
+		changed []string
+		reloads int64
+	)
+	x.OnChange(func(keys []string) {
+		changed = keys
+		// 通知时已经释放锁, 可以读取统计信息
+		reloads = x.Stats().Reloads
+	})
+
+	// 删除 host 和一个元素, 修改 level 不会生效因为命令行的优先级更高, 通过 Set 修改的值保持不变
+	assert.Nil(t, os.WriteFile(filepath, []byte("t:\n  level: warn\n  upstreams:\n    - host: u3\n"), os.ModePerm))
+	assert.Nil(t, x.Reload())
+	assert.Equal(t, &TestReloadStruct{Host: "localhost", Port: 8080, Level: "debug", Upstreams: []TestUpstream{{Host: "u3", Port: 80, Weight: 1}}}, s)
+	assert.Equal(t, []string{"t_host", "t_upstreams", "t_upstreams_0_host", "t_upstreams_1_host", "t_upstreams_1_port", "t_upstreams_1_weight"}, changed)
+	assert.Equal(t, int64(2), reloads)
+	host, _ := conf.GetAs[string](x, "t_host")
+	assert.Equal(t, "localhost", host)
+
+	// 校验失败时恢复
+	changed = nil
+	assert.Nil(t, os.WriteFile(filepath, []byte("t:\n  host: b.example.com\n  port: 10000\n  upstreams:\n    - host: u4\n    - host: u5\n"), os.ModePerm))
+	x2 := conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {}))
+	y2 := conf.NewYaml(x2)
+	y2.YamlConf.FilePath = filepath
+	s2 := &TestReloadStruct{}
+	x2.RegisterConfWithName("t", s2)
+	x2.RegisterSource(y2)
+	x2.Parse()
+	err := x2.Reload()
+	assert.ErrorIs(t, err, conf.ErrReload)
+	assert.Contains(t, err.Error(), "t_port value 10000 greater than max 9999")
+
+	strict := conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {}), conf.WithStrict(conf.StrictError))
+	y3 := conf.NewYaml(strict)
+	y3.YamlConf.FilePath = filepath
+	s3 := &TestReloadStruct{}
+	strict.RegisterConfWithName("t", s3)
+	strict.RegisterSource(y3)
+	assert.Nil(t, os.WriteFile(filepath, []byte("t:\n  host: c.example.com\n  upstreams:\n    - host: u6\n"), os.ModePerm))
+	strict.Parse()
+	assert.Nil(t, os.WriteFile(filepath, []byte("t:\n  host: b.example.com\n  upstreams:\n    - host: u4\n    - host: u5\n  unknown: 1\n"), os.ModePerm))
+	assert.ErrorIs(t, strict.Reload(), conf.ErrUnknownKey)
+	assert.Equal(t, &TestReloadStruct{Host: "c.example.com", Port: 80, Level: "info", Upstreams: []TestUpstream{{Host: "u6", Port: 80, Weight: 1}}}, s3)
+	origin := strict.Snapshot()[0].Origin
+	assert.Contains(t, origin, "yaml")
+	stats := strict.Stats()
+	assert.Equal(t, int64(2), stats.Reloads)
+	assert.Contains(t, stats.LastReloadError, "unknown key t_unknown")
+
+	// 指标
+	assert.Equal(t, []string{"flag", "yaml", "flag", "yaml"}, metrics.sources)
+	assert.Equal(t, []error{nil, nil}, metrics.reloads)
+	assert.Nil(t, changed)
+
+	// expvar
+	assert.Nil(t, x.Publish("conf_test_reload"))
+	assert.ErrorIs(t, x.Publish("conf_test_reload"), conf.ErrPublish)
+	var published struct {
+		Configs map[string]interface{} `json:"configs"`
+		Stats   conf.Stats             `json:"stats"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(expvar.Get("conf_test_reload").String()), &published))
+	assert.Equal(t, float64(8080), published.Configs["t_port"])
+	assert.Equal(t, int64(2), published.Stats.Reloads)
+	assert.Contains(t, published.Stats.SourceParseDuration, "yaml")
+}
+
+type TestLoggerStruct struct {
+	Host     string `conf:"host,default=localhost"`
+	Addr     string `conf:"addr,deprecated=use t_host"`
+	Password string `conf:"password,secret=true"`
+}
+
+type TestResultLogger struct {
+	lines []string
+	fatal []string
+}
+
+func (l *TestResultLogger) Info(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *TestResultLogger) Fatal(format string, v ...interface{}) {
+	l.fatal = append(l.fatal, fmt.Sprintf(format, v...))
+}
+
+// 测试 通过 slog 输出解析过程, 以及废弃的参数
+func TestLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	var x = conf.New(conf.WithLogger(logger), conf.WithStrict(conf.StrictWarn))
+	x.RegisterConfWithName("t", &TestLoggerStruct{})
+	x.RegisterSource(conf.NewFlagWithArgs(x, []string{"-t_addr=0.0.0.0", "-t_password=123"}))
+	x.Parse()
+	x.PrintResult()
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		record := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &record))
+		delete(record, "time")
+		delete(record, "duration")
+		records = append(records, record)
+	}
+	// 配置源中参数的顺序不固定
+	assert.ElementsMatch(t, []map[string]interface{}{
+		{"level": "DEBUG", "msg": "config key set", "key": "t_addr", "source": "flag", "value": "0.0.0.0"},
+		{"level": "WARN", "msg": "config key deprecated", "key": "t_addr", "source": "flag", "message": "use t_host"},
+		{"level": "DEBUG", "msg": "config key set", "key": "t_password", "source": "flag", "value": "******"},
+	}, records[:3])
+	assert.Equal(t, []map[string]interface{}{
+		{"level": "INFO", "msg": "config source loaded", "source": "flag", "keys": float64(2)},
+		{"level": "WARN", "msg": "config warning", "message": "key t_addr from flag is deprecated: use t_host"},
+		{"level": "INFO", "msg": "config loaded", "reloads": float64(1), "profiles": nil},
+		{"level": "INFO", "msg": "config", "key": "t_host", "value": "localhost", "default": "localhost", "origin": "default"},
+		{"level": "INFO", "msg": "config", "key": "t_addr", "value": "0.0.0.0", "default": "", "origin": "flag"},
+		{"level": "INFO", "msg": "config", "key": "t_password", "value": "******", "default": "", "origin": "flag"},
+	}, records[3:])
+
+	// 兼容 ResultLogger 和 ParseLogger
+	l := &TestResultLogger{}
+	x = conf.New(conf.WithResultLogger(l), conf.WithParseLogger(l))
+	x.RegisterConfWithName("t", &TestLoggerStruct{})
+	x.RegisterSource(conf.NewFlagWithArgs(x, []string{"-t_host=a"}))
+	x.Parse()
+	assert.Equal(t, `level=DEBUG msg="config key set" key=t_host source=flag value=a`, l.lines[0])
+	assert.Equal(t, 0, len(l.fatal))
+	x = conf.New(conf.WithResultLogger(l), conf.WithParseLogger(l))
+	x.RegisterConfWithName("t", &TestLoggerStruct{})
+	x.RegisterSource(conf.NewFlagWithArgs(x, []string{"-t_unknown=1"}))
+	// Fatal 没有退出时仍然 panic
+	assert.Panics(t, func() {
+		x.Parse()
+	})
+	assert.Equal(t, 1, len(l.fatal))
+	assert.Contains(t, l.fatal[0], "flag provided but not defined: -t_unknown")
+
+	// 文档和 schema 中标记废弃的参数
+	docs := &bytes.Buffer{}
+	assert.Nil(t, x.WriteDocs(docs, conf.DocsMarkdown))
+	assert.Contains(t, docs.String(), "| Deprecated: use t_host. |")
+	schema, err := x.JSONSchema()
+	assert.Nil(t, err)
+	assert.Contains(t, string(schema), `"deprecated": true`)
+
+	// 没有指定 logger 时通过 slog.Default() 输出
+	out := &bytes.Buffer{}
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(out, nil)))
+	defer slog.SetDefault(defaultLogger)
+	x = conf.New()
+	x.RegisterConfWithName("t", &TestLoggerStruct{})
+	x.RegisterSource(conf.NewFlagWithArgs(x, []string{"-t_host=a"}))
+	x.Parse()
+	x.PrintResult()
+	assert.Contains(t, out.String(), "msg=config key=t_host value=a default=localhost origin=flag")
+}
+
+// TestConsulServer 模拟 Consul KV 的 HTTP API, 支持 recurse 和 blocking query
+type TestConsulServer struct {
+	mu      sync.Mutex
+	index   uint64
+	data    map[string]string
+	changed chan struct{}
+	token   string
+}
+
+func (s *TestConsulServer) Put(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	s.index++
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *TestConsulServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Consul-Token") != s.token {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	s.mu.Lock()
+	if r.URL.Query().Get("index") == strconv.FormatUint(s.index, 10) {
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+		s.mu.Lock()
+	}
+	defer s.mu.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(s.index, 10))
+	var items []map[string]interface{}
+	for key, value := range s.data {
+		if strings.HasPrefix(key, prefix) {
+			items = append(items, map[string]interface{}{"Key": key, "Value": []byte(value)})
+		}
+	}
+	if len(items) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+func TestRemoteSource(t *testing.T) {
+	backend := conf.NewMemoryKV()
+	backend.Put("app/t/host", "a.example.com")
+	backend.Put("app/t/upstreams", "- host: u1\n  port: 81\n- host: u2\n")
+	backend.Put("other/t/level", "debug")
+	var x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {}))
+	remote := conf.NewRemoteSource(x, backend, "app/")
+	s := &TestReloadStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(remote)
+	x.Parse()
+	assert.Equal(t, &TestReloadStruct{Host: "a.example.com", Port: 80, Level: "info",
+		Upstreams: []TestUpstream{{Host: "u1", Port: 81, Weight: 1}, {Host: "u2", Port: 80, Weight: 1}}}, s)
+	origins := make(map[string]string)
+	for _, config := range x.Snapshot() {
+		origins[config.Key] = config.Origin
+	}
+	assert.Equal(t, "remote (app/t/host)", origins["t_host"])
+	assert.Equal(t, "remote (app/t/upstreams)", origins["t_upstreams_0_port"])
+
+	// 远程的变化触发 Reload
+	changed := make(chan []string, 1)
+	x.OnChange(func(keys []string) {
+		changed <- keys
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.Nil(t, remote.Watch(ctx))
+	backend.Put("app/t/port", "8080")
+	assert.Equal(t, []string{"t_port"}, <-changed)
+	port, _ := conf.GetAs[int](x, "t_port")
+	assert.Equal(t, 8080, port)
+
+	// Watch 在后台 Reload 时并发读取, 通过 go test -race 检查
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_, _ = conf.GetAs[int](x, "t_port")
+				_, _ = x.Get("t_upstreams")
+				_ = x.Export(io.Discard, conf.ExportYaml)
+				_ = x.Diff(x)
+				_ = x.Validate()
+				_ = x.UnmarshalKey("t", &TestReloadStruct{})
+			}
+		}
+	}()
+	for i := 1; i <= 20; i++ {
+		backend.Put("app/t/port", strconv.Itoa(8080+i))
+		assert.Equal(t, []string{"t_port"}, <-changed)
+	}
+	close(stop)
+	<-done
+	assert.Equal(t, 8100, conf.MustGet[int](x, "t_port"))
+
+	// Consul KV
+	server := &TestConsulServer{data: map[string]string{"app/t/host": "b.example.com", "app/t/port": "81"}, changed: make(chan struct{}), token: "secret"}
+	ts := httptest.NewServer(server)
+	// 先结束 Watch, 否则 Close 会等待阻塞中的请求
+	defer ts.Close()
+	defer cancel()
+	consul := conf.NewConsulKV(ts.URL)
+	consul.Token = "secret"
+	x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {}))
+	remote = conf.NewRemoteSource(x, consul, "app/")
+	s = &TestReloadStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(remote)
+	x.Parse()
+	assert.Equal(t, "b.example.com", s.Host)
+	assert.Equal(t, 81, s.Port)
+	changed = make(chan []string, 1)
+	x.OnChange(func(keys []string) {
+		changed <- keys
+	})
+	assert.Nil(t, remote.Watch(ctx))
+	server.Put("app/t/level", "warn")
+	assert.Equal(t, []string{"t_level"}, <-changed)
+	level, _ := conf.GetAs[string](x, "t_level")
+	assert.Equal(t, "warn", level)
+
+	// 没有设置 Client 时使用 http.DefaultClient
+	consul = &conf.ConsulKV{Address: ts.URL, Token: "secret", WaitTime: time.Second, RetryInterval: time.Millisecond}
+	pairs, err := consul.List(ctx, "app/")
+	assert.Nil(t, err)
+	assert.Len(t, pairs, 3)
+	_, err = consul.Watch(ctx, "app/")
+	assert.Nil(t, err)
+
+	// 没有设置 RetryInterval 时, 没有返回 X-Consul-Index 或者请求失败都等待之后再请求
+	for _, status := range []int{http.StatusOK, http.StatusInternalServerError} {
+		var requests atomic.Int64
+		plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requests.Add(1) > 1 && status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+			_, _ = w.Write([]byte("[]"))
+		}))
+		watchCtx, watchCancel := context.WithCancel(context.Background())
+		_, err = (&conf.ConsulKV{Address: plain.URL}).Watch(watchCtx, "app/")
+		assert.Nil(t, err)
+		time.Sleep(300 * time.Millisecond)
+		watchCancel()
+		plain.Close()
+		assert.LessOrEqual(t, requests.Load(), int64(3))
+	}
+
+	// 请求失败时通过 handler 返回错误
+	var result *conf.ParseResult
+	x = conf.New(conf.WithResultHandler(func(r *conf.ParseResult) {
+		result = r
+	}))
+	x.RegisterConfWithName("t", &TestReloadStruct{})
+	x.RegisterSource(conf.NewRemoteSource(x, conf.NewConsulKV(ts.URL), "app/"))
+	x.Parse()
+	assert.ErrorIs(t, result.Err, conf.ErrRemoteLoad)
+	assert.Contains(t, result.Err.Error(), "403 Forbidden")
+}
+
+// 测试 通过解码器读取其他格式的文件, profiles 以及环境对应的文件与 yaml 相同
+func TestYamlDecoder(t *testing.T) {
+	assert.Nil(t, os.WriteFile("test/decoder.json", []byte(`{"t": {"host": "a.example.com", "upstreams": [{"host": "u1"}]}, "profiles": {"prod": {"t": {"level": "warn"}}}}`), os.ModePerm))
+	assert.Nil(t, os.WriteFile("test/decoder.prod.json", []byte(`{"t": {"port": 81}}`), os.ModePerm))
+	decoder := func(content []byte) (map[string]interface{}, map[string]int, error) {
+		var data map[string]interface{}
+		err := json.Unmarshal(content, &data)
+		lines := make(map[string]int)
+		for key := range data["t"].(map[string]interface{}) {
+			lines["t_"+key] = 1
+		}
+		return data, lines, err
+	}
+	var x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {
+		assert.Nil(t, result.Err)
+	}))
+	y := conf.NewYamlWithDecoder(x, "json", decoder)
+	y.YamlConf.FilePath = "test/decoder.json"
+	y.YamlConf.Profile = "prod"
+	s := &TestReloadStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(y)
+	x.Parse()
+	assert.Equal(t, &TestReloadStruct{Host: "a.example.com", Port: 81, Level: "warn", Upstreams: []TestUpstream{{Host: "u1", Port: 80, Weight: 1}}}, s)
+	assert.Equal(t, "json", y.Name())
+	assert.Equal(t, "test/decoder.json:1", y.Location("t_host"))
+	assert.Equal(t, "test/decoder.prod.json:1", y.Location("t_port"))
+
+	// 文件不存在时不会生成模板
+	var result *conf.ParseResult
+	x = conf.New(conf.WithResultHandler(func(r *conf.ParseResult) {
+		if r.Err != nil {
+			result = r
+		}
+	}))
+	y = conf.NewYamlWithDecoder(x, "json", decoder)
+	y.YamlConf.FilePath = "test/decoder_missing.json"
+	x.RegisterConfWithName("t", &TestReloadStruct{})
+	x.RegisterSource(y)
+	x.Parse()
+	assert.ErrorIs(t, result.Err, conf.ErrReadFile)
+	_, err := os.Stat("test/decoder_missing.json")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestYamlReader(t *testing.T) {
+	var x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {}), conf.WithProfile("prod"))
+	y := conf.NewYamlWithBytes(x, []byte("t:\n  host: a.example.com\n  upstreams:\n    - host: u1\nprofiles:\n  prod:\n    t:\n      level: warn\n"))
+	s := &TestReloadStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(y)
+	x.Parse()
+	assert.Equal(t, &TestReloadStruct{Host: "a.example.com", Port: 80, Level: "warn", Upstreams: []TestUpstream{{Host: "u1", Port: 80, Weight: 1}}}, s)
+	assert.Equal(t, "-:2", y.Location("t_host"))
+	_, err := y.Sync()
+	assert.ErrorIs(t, err, conf.ErrYamlSync)
+
+	// reader 只读取一次, Reload 时使用第一次读取的内容
+	x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {}))
+	s = &TestReloadStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(conf.NewYamlWithReader(x, strings.NewReader("t:\n  port: 8080\n")))
+	x.Parse()
+	assert.Nil(t, x.Reload())
+	assert.Equal(t, 8080, s.Port)
+
+	// fs.FS 中的文件, 支持 include, glob 以及环境对应的文件, 文件不存在时不会生成
+	fsys := fstest.MapFS{
+		"conf/config.yaml":      {Data: []byte("include: base.yaml\nt:\n  host: b.example.com\n")},
+		"conf/config.prod.yaml": {Data: []byte("t:\n  level: error\n")},
+		"conf/base.yaml":        {Data: []byte("include: ../shared/host.yaml\nt:\n  port: !include port.yaml\n")},
+		"conf/port.yaml":        {Data: []byte("81\n")},
+		"shared/host.yaml":      {Data: []byte("t:\n  host: base.example.com\n")},
+		"conf.d/a.yaml":         {Data: []byte("t:\n  upstreams:\n    - host: u2\n")},
+	}
+	x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {}))
+	y = conf.NewYamlWithFS(x, fsys)
+	y.YamlConf.FilePath = "conf/config.yaml,conf.d/*.yaml"
+	y.YamlConf.Profile = "prod"
+	s = &TestReloadStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(y)
+	x.Parse()
+	assert.Equal(t, &TestReloadStruct{Host: "b.example.com", Port: 81, Level: "error", Upstreams: []TestUpstream{{Host: "u2", Port: 80, Weight: 1}}}, s)
+	assert.Equal(t, "conf/base.yaml:3", y.Location("t_port"))
+	var result *conf.ParseResult
+	x = conf.New(conf.WithResultHandler(func(r *conf.ParseResult) {
+		if r.Err != nil {
+			result = r
+		}
+	}))
+	y = conf.NewYamlWithFS(x, fsys)
+	y.YamlConf.FilePath = "missing.yaml"
+	x.RegisterConfWithName("t", &TestReloadStruct{})
+	x.RegisterSource(y)
+	x.Parse()
+	assert.ErrorIs(t, result.Err, conf.ErrYamlLoad)
+
+	// - 从标准输入读取
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+	}()
+	_, _ = w.WriteString("t:\n  host: stdin.example.com\n")
+	_ = w.Close()
+	x = conf.New(conf.WithResultHandler(func(result *conf.ParseResult) {}))
+	y = conf.NewYaml(x)
+	y.YamlConf.FilePath = "-"
+	s = &TestReloadStruct{}
+	x.RegisterConfWithName("t", s)
+	x.RegisterSource(y)
+	x.Parse()
+	assert.Equal(t, "stdin.example.com", s.Host)
 }
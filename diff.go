@@ -0,0 +1,119 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type DiffKind string
+
+const (
+	DiffAdded   DiffKind = "added"
+	DiffRemoved DiffKind = "removed"
+	DiffChanged DiffKind = "changed"
+)
+
+// ConfigDiff 两份配置中一个参数的差异, 敏感信息的值会被隐藏
+type ConfigDiff struct {
+	Key  string   `json:"key"`
+	Kind DiffKind `json:"kind"`
+	// 旧配置中的值和来源, 新增的参数为空
+	Old       interface{} `json:"old,omitempty"`
+	OldOrigin string      `json:"oldOrigin,omitempty"`
+	// 新配置中的值和来源, 删除的参数为空
+	New       interface{} `json:"new,omitempty"`
+	NewOrigin string      `json:"newOrigin,omitempty"`
+}
+
+func (d ConfigDiff) String() string {
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("+ %s: %v%s", d.Key, d.New, originSuffix(d.NewOrigin))
+	case DiffRemoved:
+		return fmt.Sprintf("- %s: %v%s", d.Key, d.Old, originSuffix(d.OldOrigin))
+	}
+	origin := ""
+	if d.OldOrigin != "" || d.NewOrigin != "" {
+		origin = originSuffix(d.OldOrigin + " -> " + d.NewOrigin)
+	}
+	return fmt.Sprintf("~ %s: %v -> %v%s", d.Key, d.Old, d.New, origin)
+}
+
+func originSuffix(origin string) string {
+	if origin == "" {
+		return ""
+	}
+	return fmt.Sprintf(" [%s]", origin)
+}
+
+// Diff 比较当前配置与 other 的差异, 见 Diff
+func (x *X) Diff(other *X) []ConfigDiff {
+	return Diff(x.Snapshot(), other.Snapshot())
+}
+
+// PrintDiff 比较当前配置与 other 的差异, 并通过 handler 输出
+func (x *X) PrintDiff(other *X) {
+	x.handler(NewParseResultDiff(x.Diff(other)))
+}
+
+// Diff 按照参数逐个比较两份配置, 顺序与 a 一致, 只在 b 中出现的参数放在最后
+// 敏感信息按照实际的值比较, 输出时隐藏
+func Diff(a, b []ConfigResult) []ConfigDiff {
+	index := make(map[string]int, len(b))
+	for i, config := range b {
+		index[config.Key] = i
+	}
+	var diffs []ConfigDiff
+	seen := make(map[string]bool, len(a))
+	for _, old := range a {
+		seen[old.Key] = true
+		i, has := index[old.Key]
+		if !has {
+			diffs = append(diffs, ConfigDiff{Key: old.Key, Kind: DiffRemoved, Old: old.Value, OldOrigin: old.Origin})
+			continue
+		}
+		if configEqual(old, b[i]) {
+			continue
+		}
+		diffs = append(diffs, ConfigDiff{
+			Key:       old.Key,
+			Kind:      DiffChanged,
+			Old:       old.Value,
+			OldOrigin: old.Origin,
+			New:       b[i].Value,
+			NewOrigin: b[i].Origin,
+		})
+	}
+	for _, config := range b {
+		if !seen[config.Key] {
+			diffs = append(diffs, ConfigDiff{Key: config.Key, Kind: DiffAdded, New: config.Value, NewOrigin: config.Origin})
+		}
+	}
+	return diffs
+}
+
+// configEqual 比较两个参数的值, 不是通过 Snapshot 得到的结果比较隐藏后的值
+func configEqual(a, b ConfigResult) bool {
+	va, vb := a.raw, b.raw
+	if va == nil || vb == nil {
+		va, vb = a.Value, b.Value
+	}
+	if reflect.DeepEqual(va, vb) {
+		return true
+	}
+	// 不同实例中同一个参数的类型可能不同, 例如 int 和 int64
+	return fmt.Sprint(va) == fmt.Sprint(vb)
+}
+
+// DiffText 将差异转换为文本, 每个参数一行
+func DiffText(diffs []ConfigDiff) string {
+	lines := make([]string, 0, len(diffs))
+	for _, diff := range diffs {
+		lines = append(lines, diff.String())
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
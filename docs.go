@@ -0,0 +1,191 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+type DocsFormat string
+
+const (
+	DocsMarkdown DocsFormat = "markdown"
+	DocsHtml     DocsFormat = "html"
+)
+
+var ErrDocsFormat = errors.New("docs format not support")
+
+// 结构体切片元素下标的占位符, 例如 t_upstreams_<i>_host
+const docsIndex = "<i>"
+
+type docRow struct {
+	Key         string
+	Flag        string
+	Env         string
+	YamlPath    string
+	Type        string
+	Default     string
+	Required    bool
+	Description string
+}
+
+// WriteDocs 根据注册的参数生成配置说明文档, 按照注册顺序每个参数一行
+// 包括完整的键, 命令行参数, 环境变量, yaml 路径, 类型, 默认值, 是否必填以及描述
+// 可以在 go generate 中调用以保持文档与代码一致
+func (x *X) WriteDocs(w io.Writer, format DocsFormat) error {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	rows := x.docRows(x.argTree, []string{}, 0, "")
+	var content string
+	switch format {
+	case DocsMarkdown:
+		content = markdownDocs(rows)
+	case DocsHtml:
+		content = htmlDocs(rows)
+	default:
+		return errors.Join(ErrDocsFormat, errors.New(fmt.Sprintf("format:%s", format)))
+	}
+	_, err := io.WriteString(w, content)
+	return err
+}
+
+// docRows 按照注册顺序收集 tree 下所有参数的说明, 结构体切片使用示例元素并以 <i> 表示下标
+// 示例元素的参数注册在独立的实例中, 查找参数时跳过 path 的前 skip 段
+func (x *X) docRows(tree *argTree, prefix []string, skip int, yamlPrefix string) []docRow {
+	var rows []docRow
+	for _, child := range tree.child {
+		path := append(append([]string{}, prefix...), child.key)
+		yamlPath := child.key
+		if yamlPrefix != "" {
+			yamlPath = yamlPrefix + "." + child.key
+		}
+		switch {
+		case child.slice != nil:
+			rows = append(rows, newDocRow(path, yamlPath, "[]object", child.slice))
+			tmp, elemTree := child.slice.example()
+			elemPath := append(path, docsIndex)
+			rows = append(rows, tmp.docRows(elemTree, elemPath, len(elemPath), yamlPath+"[]")...)
+		case len(child.child) == 0:
+			arg, has := x.kv.Get(strings.Join(path[skip:], "_"))
+			if !has {
+				continue
+			}
+			rows = append(rows, newDocRow(path, yamlPath, argTypeName(arg), arg))
+		default:
+			rows = append(rows, x.docRows(child, path, skip, yamlPath)...)
+		}
+	}
+	return rows
+}
+
+func newDocRow(path []string, yamlPath string, typeName string, arg Arg) docRow {
+	key := strings.Join(path, "_")
+	flag := "-" + key
+	// 布尔参数同时显示取反的形式
+	if _, ok := arg.(*Bool); ok {
+		flag = fmt.Sprintf("-%s, -%s%s", key, negationPrefix, key)
+	}
+	def := maskDefault(arg)
+	if _, ok := arg.(*Slice); ok {
+		def = strings.ReplaceAll(def, "|", ",")
+	}
+	desc := arg.GetDescription()
+	if rule := argRule(arg); rule.Deprecated {
+		deprecated := "Deprecated."
+		if rule.DeprecatedMessage != "" {
+			deprecated = fmt.Sprintf("Deprecated: %s.", rule.DeprecatedMessage)
+		}
+		desc = strings.TrimSpace(deprecated + " " + desc)
+	}
+	return docRow{
+		Key:         key,
+		Flag:        flag,
+		Env:         strings.ReplaceAll(envName(key), strings.ToUpper(docsIndex), docsIndex),
+		YamlPath:    yamlPath,
+		Type:        typeName,
+		Default:     def,
+		Required:    argRule(arg).Required,
+		Description: desc,
+	}
+}
+
+// argTypeName 返回参数对应字段的类型名称
+func argTypeName(arg Arg) string {
+	switch a := arg.(type) {
+	case *Bool:
+		return a.rValue.Type().String()
+	case *Int:
+		return a.rValue.Type().String()
+	case *Uint:
+		return a.rValue.Type().String()
+	case *Float:
+		return a.rValue.Type().String()
+	case *String:
+		return a.rValue.Type().String()
+	case *Slice:
+		return a.rValue.Type().String()
+	case *ByteSizeArg:
+		return "bytesize"
+	case *PercentArg:
+		return "percent"
+	}
+	return "any"
+}
+
+var docsHeader = []string{"Key", "Flag", "Env", "YAML", "Type", "Default", "Required", "Description"}
+
+func (r docRow) cells() []string {
+	required := ""
+	if r.Required {
+		required = "yes"
+	}
+	return []string{r.Key, r.Flag, r.Env, r.YamlPath, r.Type, r.Default, required, r.Description}
+}
+
+func markdownDocs(rows []docRow) string {
+	builder := &strings.Builder{}
+	builder.WriteString("| " + strings.Join(docsHeader, " | ") + " |\n")
+	builder.WriteString(strings.Repeat("| --- ", len(docsHeader)) + "|\n")
+	for _, row := range rows {
+		cells := row.cells()
+		for i, cell := range cells {
+			cell = markdownEscape(cell)
+			// 描述和必填之外的列作为代码显示
+			if cell != "" && i < 6 {
+				cell = "`" + cell + "`"
+			}
+			cells[i] = cell
+		}
+		builder.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	return builder.String()
+}
+
+func markdownEscape(cell string) string {
+	cell = strings.ReplaceAll(cell, "|", "\\|")
+	return strings.ReplaceAll(cell, "\n", " ")
+}
+
+func htmlDocs(rows []docRow) string {
+	builder := &strings.Builder{}
+	builder.WriteString("<table>\n<thead>\n<tr>")
+	for _, header := range docsHeader {
+		builder.WriteString("<th>" + header + "</th>")
+	}
+	builder.WriteString("</tr>\n</thead>\n<tbody>\n")
+	for _, row := range rows {
+		builder.WriteString("<tr>")
+		for i, cell := range row.cells() {
+			cell = html.EscapeString(cell)
+			if cell != "" && i < 6 {
+				cell = "<code>" + cell + "</code>"
+			}
+			builder.WriteString("<td>" + cell + "</td>")
+		}
+		builder.WriteString("</tr>\n")
+	}
+	builder.WriteString("</tbody>\n</table>\n")
+	return builder.String()
+}
@@ -0,0 +1,235 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type ExportFormat string
+
+const (
+	ExportYaml ExportFormat = "yaml"
+	ExportJson ExportFormat = "json"
+	ExportEnv  ExportFormat = "env"
+	ExportFlag ExportFormat = "flag"
+)
+
+var (
+	ErrExportFormat = errors.New("export format not support")
+	ErrExport       = errors.New("export err")
+)
+
+// Export 将解析后的配置按照指定格式写入 w, 敏感信息会被隐藏
+func (x *X) Export(w io.Writer, format ExportFormat) error {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var (
+		content []byte
+		err     error
+	)
+	switch format {
+	case ExportYaml:
+		content, err = x.exportYaml()
+	case ExportJson:
+		content, err = x.exportJson()
+	case ExportEnv:
+		content = x.exportEnv()
+	case ExportFlag:
+		content = x.exportFlag()
+	default:
+		return errors.Join(ErrExportFormat, errors.New(fmt.Sprintf("format:%s", format)))
+	}
+	if err != nil {
+		return errors.Join(ErrExport, err)
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+func (x *X) exportYaml() ([]byte, error) {
+	node, err := x.exportNode(x.argTree, []string{})
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	err = encoder.Encode(node)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (x *X) exportJson() ([]byte, error) {
+	node, err := x.exportNode(x.argTree, []string{})
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	err = writeJsonNode(buf, node)
+	if err != nil {
+		return nil, err
+	}
+	ret := &bytes.Buffer{}
+	err = json.Indent(ret, buf.Bytes(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	ret.WriteByte('\n')
+	return ret.Bytes(), nil
+}
+
+func (x *X) exportEnv() []byte {
+	buf := &bytes.Buffer{}
+	x.rangeArgTree(x.argTree, []string{}, func(path []string, arg Arg) {
+		buf.WriteString(fmt.Sprintf("%s=%s\n", envName(strings.Join(path, "_")), envQuote(flatValue(arg))))
+	})
+	return buf.Bytes()
+}
+
+func (x *X) exportFlag() []byte {
+	var flags []string
+	x.rangeArgTree(x.argTree, []string{}, func(path []string, arg Arg) {
+		flags = append(flags, shellQuote(fmt.Sprintf("-%s=%s", strings.Join(path, "_"), flatValue(arg))))
+	})
+	return []byte(strings.Join(flags, " ") + "\n")
+}
+
+// flatValue 命令行和环境变量中使用的值, 切片的元素使用逗号连接, 与 Slice.SetValue 解析的格式相同
+func flatValue(arg Arg) string {
+	if _, ok := arg.(*Slice); !ok || isSecret(arg) {
+		return fmt.Sprint(maskValue(arg))
+	}
+	rv := reflect.ValueOf(arg.GetValue())
+	items := make([]string, rv.Len())
+	for i := range items {
+		items[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+	return strings.Join(items, ",")
+}
+
+// exportNode 根据 argTree 构建保持注册顺序的 yaml 节点, 值为参数的实际类型
+func (x *X) exportNode(tree *argTree, prefix []string) (*yaml.Node, error) {
+	return x.yamlNode(tree, prefix, false, func(arg Arg) (*yaml.Node, error) {
+		value := &yaml.Node{}
+		err := value.Encode(maskValue(arg))
+		return value, err
+	})
+}
+
+// yamlNode 根据 argTree 构建保持注册顺序的 yaml 节点, 叶子节点的值由 valueNode 生成
+// 参数的描述会作为键的注释, example 为 true 时结构体切片输出一个示例元素
+func (x *X) yamlNode(tree *argTree, prefix []string, example bool, valueNode func(arg Arg) (*yaml.Node, error)) (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	path := prefix
+	if tree.key != "" {
+		path = append(append([]string{}, prefix...), tree.key)
+	}
+	for _, child := range tree.child {
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Value: child.key}
+		var value *yaml.Node
+		if child.slice != nil {
+			var err error
+			value, err = x.sliceNode(child, path, example, valueNode)
+			if err != nil {
+				return nil, err
+			}
+			keyNode.HeadComment = child.slice.GetDescription()
+		} else if len(child.child) == 0 {
+			arg, has := x.kv.Get(strings.Join(append(append([]string{}, path...), child.key), "_"))
+			if !has {
+				continue
+			}
+			var err error
+			value, err = valueNode(arg)
+			if err != nil {
+				return nil, err
+			}
+			keyNode.HeadComment = arg.GetDescription()
+		} else {
+			var err error
+			value, err = x.yamlNode(child, path, example, valueNode)
+			if err != nil {
+				return nil, err
+			}
+		}
+		node.Content = append(node.Content, keyNode, value)
+	}
+	return node, nil
+}
+
+// sliceNode 构建结构体切片的 yaml 节点, 每个元素为一个 mapping
+func (x *X) sliceNode(tree *argTree, prefix []string, example bool, valueNode func(arg Arg) (*yaml.Node, error)) (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.SequenceNode}
+	if example {
+		tmp, elemTree := tree.slice.example()
+		elem, err := tmp.yamlNode(elemTree, []string{}, true, valueNode)
+		if err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, elem)
+		return node, nil
+	}
+	path := append(append([]string{}, prefix...), tree.key)
+	for _, elemTree := range tree.child {
+		elem, err := x.yamlNode(elemTree, path, false, valueNode)
+		if err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, elem)
+	}
+	return node, nil
+}
+
+// writeJsonNode 将 yaml 节点按顺序写成 json
+func writeJsonNode(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(node.Content[i].Value)
+			buf.Write(key)
+			buf.WriteByte(':')
+			err := writeJsonNode(buf, node.Content[i+1])
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			err := writeJsonNode(buf, item)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		var v interface{}
+		err := node.Decode(&v)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(value)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	ErrKeyNotFound  = errors.New("key not found")
+	ErrTypeMismatch = errors.New("type mismatch")
+)
+
+// GetAs 获取参数的值并转换为 T, 数值类型之间精确转换并检查溢出
+// 参数不存在时返回 ErrKeyNotFound, 无法转换时返回 ErrTypeMismatch
+func GetAs[T any](x *X, key string) (T, error) {
+	var ret T
+	v, has := x.Get(key)
+	if !has {
+		return ret, errors.Join(ErrKeyNotFound, errors.New(fmt.Sprintf("key:%s", key)))
+	}
+	if vv, ok := v.(T); ok {
+		return vv, nil
+	}
+	rv, err := convertValue(v, reflect.TypeOf(&ret).Elem())
+	if err != nil {
+		return ret, errors.Join(errors.New(fmt.Sprintf("key:%s", key)), err)
+	}
+	return rv.Interface().(T), nil
+}
+
+// MustGet 与 GetAs 相同, 出错时 panic
+func MustGet[T any](x *X, key string) T {
+	ret, err := GetAs[T](x, key)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// GetOr 与 GetAs 相同, 出错时返回 def
+func GetOr[T any](x *X, key string, def T) T {
+	ret, err := GetAs[T](x, key)
+	if err != nil {
+		return def
+	}
+	return ret
+}
+
+// convertValue 将 v 转换为 t 类型
+func convertValue(v interface{}, t reflect.Type) (reflect.Value, error) {
+	mismatch := errors.Join(ErrTypeMismatch, errors.New(fmt.Sprintf("%T can not convert to %s", v, t)))
+	if v == nil {
+		return reflect.Value{}, mismatch
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Type() == t {
+		return rv, nil
+	}
+	if t.Kind() == reflect.Interface {
+		if rv.Type().Implements(t) {
+			return rv.Convert(t), nil
+		}
+		return reflect.Value{}, mismatch
+	}
+	// 数值统一为 int64, uint64 或 float64 后再转换
+	var number interface{}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number = rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number = rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		number = rv.Float()
+	}
+	ret := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if number == nil {
+			return reflect.Value{}, mismatch
+		}
+		n, err := toInt64(number)
+		if err != nil {
+			return reflect.Value{}, errors.Join(ErrTypeMismatch, err)
+		}
+		if ret.OverflowInt(n) {
+			return reflect.Value{}, errors.Join(ErrTypeMismatch, errOutOfRange(v, t))
+		}
+		ret.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if number == nil {
+			return reflect.Value{}, mismatch
+		}
+		n, err := toUint64(number)
+		if err != nil {
+			return reflect.Value{}, errors.Join(ErrTypeMismatch, err)
+		}
+		if ret.OverflowUint(n) {
+			return reflect.Value{}, errors.Join(ErrTypeMismatch, errOutOfRange(v, t))
+		}
+		ret.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if number == nil {
+			return reflect.Value{}, mismatch
+		}
+		n, err := toFloat64(number)
+		if err != nil {
+			return reflect.Value{}, errors.Join(ErrTypeMismatch, err)
+		}
+		if ret.OverflowFloat(n) {
+			return reflect.Value{}, errors.Join(ErrTypeMismatch, errOutOfRange(v, t))
+		}
+		ret.SetFloat(n)
+	case reflect.String:
+		switch {
+		case rv.Kind() == reflect.String:
+			ret.SetString(rv.String())
+		case rv.Type().Implements(stringerType):
+			ret.SetString(v.(fmt.Stringer).String())
+		default:
+			return reflect.Value{}, mismatch
+		}
+	default:
+		if rv.Kind() != t.Kind() || !rv.Type().ConvertibleTo(t) {
+			return reflect.Value{}, mismatch
+		}
+		return rv.Convert(t), nil
+	}
+	return ret, nil
+}
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
@@ -0,0 +1,147 @@
+package conf
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 请求体的最大长度
+const maxHandlerBody = 1 << 20
+
+type HandlerOption func(h *handler)
+
+// WithHandlerAuth 允许通过 PUT 修改配置, auth 返回 false 时拒绝请求
+func WithHandlerAuth(auth func(r *http.Request) bool) HandlerOption {
+	return func(h *handler) {
+		h.auth = auth
+	}
+}
+
+// WithHandlerToken 允许通过 PUT 修改配置, 请求需要携带 Authorization: Bearer <token>
+func WithHandlerToken(token string) HandlerOption {
+	return WithHandlerAuth(func(r *http.Request) bool {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return ok && token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+	})
+}
+
+type handler struct {
+	x    *X
+	auth func(r *http.Request) bool
+}
+
+// HandlerResult GET 和 PUT 返回的内容
+type HandlerResult struct {
+	Profiles []string       `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+	Configs  []ConfigResult `json:"configs" yaml:"configs"`
+}
+
+// Handler 返回输出当前配置的 http.Handler, 敏感信息会被隐藏, 并包括值的来源
+// GET 默认输出 json, 通过 ?format=yaml 或者 Accept 头输出 yaml, 通过 ?prefix=t_ 过滤参数
+// 通过 WithHandlerAuth 或 WithHandlerToken 开启 PUT, 请求体为 json 或 yaml 的键值, 校验后原子地修改, 不存在的参数返回错误
+func Handler(x *X, opts ...HandlerOption) http.Handler {
+	h := &handler{x: x}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPut:
+		if h.auth == nil {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !h.auth(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		err := h.put(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		allow := "GET, HEAD"
+		if h.auth != nil {
+			allow += ", PUT"
+		}
+		w.Header().Set("Allow", allow)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.write(w, r)
+}
+
+// put 解析请求体并通过 SetMany 修改配置, 嵌套的键会被展开, 例如 {"t": {"port": 80}} -> t_port
+func (h *handler) put(r *http.Request) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxHandlerBody))
+	if err != nil {
+		return err
+	}
+	data := make(map[string]interface{})
+	if isYamlContent(r.Header.Get("Content-Type")) {
+		err = yaml.Unmarshal(body, &data)
+	} else {
+		err = json.Unmarshal(body, &data)
+	}
+	if err != nil {
+		return err
+	}
+	values := make(map[string]interface{})
+	flattenMap(data, "", func(key string, value interface{}) {
+		values[key] = value
+	})
+	// 不允许通过接口创建新的参数
+	return h.x.setMany(values, true)
+}
+
+func (h *handler) write(w http.ResponseWriter, r *http.Request) {
+	h.x.mu.RLock()
+	defer h.x.mu.RUnlock()
+	result := HandlerResult{Profiles: h.x.Profiles(), Configs: []ConfigResult{}}
+	prefix := r.URL.Query().Get("prefix")
+	for _, config := range h.x.snapshot() {
+		if strings.HasPrefix(config.Key, prefix) {
+			result.Configs = append(result.Configs, config)
+		}
+	}
+	var (
+		content []byte
+		err     error
+	)
+	format := r.URL.Query().Get("format")
+	if format == "yaml" || (format == "" && isYamlContent(r.Header.Get("Accept"))) {
+		w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+		buf := &bytes.Buffer{}
+		encoder := yaml.NewEncoder(buf)
+		encoder.SetIndent(2)
+		err = encoder.Encode(result)
+		content = buf.Bytes()
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		content, err = json.MarshalIndent(result, "", "  ")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(content)
+}
+
+func isYamlContent(contentType string) bool {
+	return strings.Contains(contentType, "yaml")
+}
@@ -27,10 +27,25 @@ func Set(str string, v interface{}) error {
 	return nx.Set(str, v)
 }
 
-func Parse() {
-	nx.Parse()
+func Parse() error {
+	return nx.Parse()
 }
 
 func PrintResult() {
 	nx.PrintResult()
 }
+
+// Value 使用单例获取参数的值并转换为 T, 与 GetAs 相同
+func Value[T any](key string) (T, error) {
+	return GetAs[T](nx, key)
+}
+
+// MustValue 使用单例获取参数的值, 与 MustGet 相同
+func MustValue[T any](key string) T {
+	return MustGet[T](nx, key)
+}
+
+// ValueOr 使用单例获取参数的值, 与 GetOr 相同
+func ValueOr[T any](key string, def T) T {
+	return GetOr[T](nx, key, def)
+}
@@ -6,6 +6,16 @@ type Source interface {
 	Range(f func(key string, value interface{}) bool)
 }
 
+// NamedSource 可选接口, 返回配置源的名称
+type NamedSource interface {
+	Name() string
+}
+
+// SourceLocator 可选接口, 返回参数在配置源中的位置, 例如 config.yaml:3
+type SourceLocator interface {
+	Location(key string) string
+}
+
 type Arg interface {
 	SetValue(v interface{}) error
 	GetValue() interface{}
@@ -17,10 +27,30 @@ type Arg interface {
 	Set()
 }
 
+// SecretArg 可选接口, 敏感信息在输出时会被隐藏, 通过标签中的 secret=true 设置
+type SecretArg interface {
+	SetSecret(secret bool)
+	IsSecret() bool
+}
+
+// OriginArg 可选接口, 记录参数的值来自哪里, 例如 default, flag, yaml (config.yaml:3), set
+type OriginArg interface {
+	SetOrigin(origin string)
+	GetOrigin() string
+}
+
+// RuleArg 可选接口, 参数的校验规则, 通过标签中的 required, enum, min, max 设置
+type RuleArg interface {
+	SetRule(rule Rule)
+	GetRule() Rule
+}
+
+// ParseLogger 通过 WithParseLogger 设置, 解析失败时调用 Fatal
 type ParseLogger interface {
 	Fatal(format string, v ...interface{})
 }
 
+// ResultLogger 通过 WithResultLogger 设置, 每条结构化的记录调用一次 Info
 type ResultLogger interface {
 	Info(format string, v ...interface{})
 }
@@ -0,0 +1,26 @@
+// Package yamlnode 读取 yaml.Node 的辅助函数, conf 和 cmd/conf 共用
+package yamlnode
+
+import "gopkg.in/yaml.v3"
+
+// Index 返回键在 mapping 节点中的位置, 不存在或者不是 mapping 节点时返回 -1
+func Index(node *yaml.Node, key string) int {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Value 返回 mapping 节点中键对应的值, 不存在时返回 nil
+func Value(node *yaml.Node, key string) *yaml.Node {
+	index := Index(node, key)
+	if index < 0 {
+		return nil
+	}
+	return node.Content[index+1]
+}
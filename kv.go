@@ -19,6 +19,10 @@ func (k *kv[V]) Set(str string, v V) {
 	k.keyValue[str] = v
 }
 
+func (k *kv[V]) Delete(str string) {
+	delete(k.keyValue, str)
+}
+
 func (k *kv[V]) Range(f func(key string, value V) bool) {
 	for key, value := range k.keyValue {
 		if !f(key, value) {
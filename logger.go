@@ -1,12 +1,103 @@
 package conf
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
 
-func resultHandler(result *ParseResult) {
-	if result.Err != nil {
-		panic(fmt.Sprintf("config parse fail: %s", result.Err))
+// WithLogger 通过 slog 输出解析过程, 包括配置源的加载, 参数的设置, 未知和废弃的参数以及 Reload
+// 没有通过 WithResultHandler 指定 handler 时, PrintResult 等结果也通过 logger 输出
+func WithLogger(logger *slog.Logger) BuildFunc {
+	return func(x *X) {
+		x.logger = logger
 	}
-	for _, config := range result.configs {
-		fmt.Println(fmt.Sprintf("-%s:%v, default:%s, usage:%s", config.Key, config.Value, config.Default, config.Usage))
+}
+
+// WithParseLogger 解析失败时先通过 ParseLogger.Fatal 输出错误, Fatal 没有退出时仍然 panic
+func WithParseLogger(l ParseLogger) BuildFunc {
+	return func(x *X) {
+		x.parseLogger = l
+	}
+}
+
+// WithResultLogger 使用 ResultLogger 输出, 每条记录格式化为 key=value 的一行
+func WithResultLogger(l ResultLogger) BuildFunc {
+	return WithLogger(slog.New(slog.NewTextHandler(resultLoggerWriter{l}, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		// 时间由 ResultLogger 输出
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})))
+}
+
+type resultLoggerWriter struct {
+	l ResultLogger
+}
+
+func (w resultLoggerWriter) Write(p []byte) (int, error) {
+	w.l.Info("%s", strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// log 输出一条结构化的记录, 没有设置 logger 时忽略
+func (x *X) log(level slog.Level, msg string, args ...any) {
+	if x.logger == nil {
+		return
+	}
+	x.logger.Log(context.Background(), level, msg, args...)
+}
+
+// defaultHandler 没有通过 WithResultHandler 指定 handler 时使用
+// 结果通过 logger 输出, 没有设置 logger 时使用 slog.Default(), 设置了 ParseLogger 时错误先通过 Fatal 输出
+func defaultHandler(logger *slog.Logger, fatal ParseLogger) ConfigResultHandler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(result *ParseResult) {
+		// 帮助信息已经输出, 由调用 Parse 的程序决定是否退出
+		if errors.Is(result.Err, ErrHelp) {
+			return
+		}
+		if result.Err != nil {
+			logger.Error("config parse fail", "err", result.Err)
+			if fatal != nil {
+				fatal.Fatal("config parse fail: %s", result.Err)
+			}
+			panic(fmt.Sprintf("config parse fail: %s", result.Err))
+		}
+		for _, warning := range result.Warnings {
+			logger.Warn("config warning", "message", warning)
+		}
+		if len(result.Profiles) > 0 {
+			logger.Info("config profiles", "profiles", result.Profiles)
+		}
+		for _, config := range result.configs {
+			logger.Info("config", "key", config.Key, "value", config.Value, "default", config.Default, "origin", config.Origin)
+		}
+		for _, diff := range result.diffs {
+			logger.Info("config diff", "key", diff.Key, "kind", diff.Kind, "old", diff.Old, "new", diff.New,
+				"oldOrigin", diff.OldOrigin, "newOrigin", diff.NewOrigin)
+		}
+	}
+}
+
+// checkDeprecated 参数被废弃时输出警告, 并返回警告信息
+func (x *X) checkDeprecated(key string, arg Arg) string {
+	rule := argRule(arg)
+	if !rule.Deprecated {
+		return ""
+	}
+	x.log(slog.LevelWarn, "config key deprecated", "key", key, "source", argOrigin(arg), "message", rule.DeprecatedMessage)
+	message := fmt.Sprintf("key %s from %s is deprecated", key, argOrigin(arg))
+	if rule.DeprecatedMessage != "" {
+		message += ": " + rule.DeprecatedMessage
 	}
+	return message
 }
@@ -0,0 +1,153 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// toInt64 将字符串或者数值精确地转换为 int64
+// 字符串支持 0x, 0o, 0b 前缀以及 _ 分隔符, 浮点数必须是整数
+func toInt64(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case string:
+		str, base := intBase(strings.TrimSpace(n))
+		ret, err := strconv.ParseInt(str, base, 64)
+		if err != nil {
+			return 0, numError(v, "int", err)
+		}
+		return ret, nil
+	case int:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case int32:
+		return int64(n), nil
+	case int16:
+		return int64(n), nil
+	case int8:
+		return int64(n), nil
+	case uint, uint64, uint32, uint16, uint8:
+		u, _ := toUint64(n)
+		if u > math.MaxInt64 {
+			return 0, errOutOfRange(v, reflect.TypeOf(int64(0)))
+		}
+		return int64(u), nil
+	case float64, float32:
+		f, _ := toFloat64(n)
+		if f != math.Trunc(f) {
+			return 0, errors.Join(ErrInvalidValue, errors.New(fmt.Sprintf("%v is not an integer", v)))
+		}
+		if f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, errOutOfRange(v, reflect.TypeOf(int64(0)))
+		}
+		return int64(f), nil
+	default:
+		return 0, errors.Join(ErrInvalidValue, errors.New(fmt.Sprintf("%v(%T) can not convert to int", v, v)))
+	}
+}
+
+// toUint64 将字符串或者数值精确地转换为 uint64, 负数返回错误
+func toUint64(v interface{}) (uint64, error) {
+	switch n := v.(type) {
+	case string:
+		str := strings.TrimSpace(n)
+		if strings.HasPrefix(str, "-") {
+			return 0, errOutOfRange(v, reflect.TypeOf(uint64(0)))
+		}
+		str, base := intBase(str)
+		ret, err := strconv.ParseUint(str, base, 64)
+		if err != nil {
+			return 0, numError(v, "uint", err)
+		}
+		return ret, nil
+	case uint:
+		return uint64(n), nil
+	case uint64:
+		return n, nil
+	case uint32:
+		return uint64(n), nil
+	case uint16:
+		return uint64(n), nil
+	case uint8:
+		return uint64(n), nil
+	case int, int64, int32, int16, int8:
+		i, _ := toInt64(n)
+		if i < 0 {
+			return 0, errOutOfRange(v, reflect.TypeOf(uint64(0)))
+		}
+		return uint64(i), nil
+	case float64, float32:
+		f, _ := toFloat64(n)
+		if f != math.Trunc(f) {
+			return 0, errors.Join(ErrInvalidValue, errors.New(fmt.Sprintf("%v is not an integer", v)))
+		}
+		if f < 0 || f >= math.MaxUint64 {
+			return 0, errOutOfRange(v, reflect.TypeOf(uint64(0)))
+		}
+		return uint64(f), nil
+	default:
+		return 0, errors.Join(ErrInvalidValue, errors.New(fmt.Sprintf("%v(%T) can not convert to uint", v, v)))
+	}
+}
+
+// toFloat64 将字符串或者数值转换为 float64, 整数超出 float64 的精确范围时返回错误
+func toFloat64(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case string:
+		ret, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if err != nil {
+			return 0, numError(v, "float", err)
+		}
+		return ret, nil
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int, int64, int32, int16, int8:
+		i, _ := toInt64(n)
+		if f := float64(i); f >= math.MaxInt64 || int64(f) != i {
+			return 0, errors.Join(ErrInvalidValue, errors.New(fmt.Sprintf("%v can not be represented exactly as float", v)))
+		}
+		return float64(i), nil
+	case uint, uint64, uint32, uint16, uint8:
+		u, _ := toUint64(n)
+		if f := float64(u); f >= math.MaxUint64 || uint64(f) != u {
+			return 0, errors.Join(ErrInvalidValue, errors.New(fmt.Sprintf("%v can not be represented exactly as float", v)))
+		}
+		return float64(u), nil
+	default:
+		return 0, errors.Join(ErrInvalidValue, errors.New(fmt.Sprintf("%v(%T) can not convert to float", v, v)))
+	}
+}
+
+// intBase 返回 strconv 解析整数使用的字符串和进制
+// 只有 0x, 0o, 0b 前缀使用对应的进制, 其他按照十进制解析, 例如 010 为 10 而不是八进制的 8, 08080 为 8080
+// 十进制中的 _ 只能出现在数字之间, 解析前删除, 其他位置的 _ 保留并由 strconv 返回错误
+func intBase(str string) (string, int) {
+	sign, digits := "", str
+	if strings.HasPrefix(digits, "+") || strings.HasPrefix(digits, "-") {
+		sign, digits = digits[:1], digits[1:]
+	}
+	if len(digits) > 1 && digits[0] == '0' && strings.ContainsRune("xXoObB", rune(digits[1])) {
+		return str, 0
+	}
+	if strings.HasPrefix(digits, "_") || strings.HasSuffix(digits, "_") || strings.Contains(digits, "__") {
+		return str, 10
+	}
+	return sign + strings.ReplaceAll(digits, "_", ""), 10
+}
+
+func numError(v interface{}, kind string, err error) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return errors.Join(ErrValueOutOfRange, errors.New(fmt.Sprintf("%v overflows %s64", v, kind)))
+	}
+	return errors.Join(ErrInvalidValue, errors.New(fmt.Sprintf("%q is not a valid %s", v, kind)))
+}
+
+func errOutOfRange(v interface{}, t reflect.Type) error {
+	return errors.Join(ErrValueOutOfRange, errors.New(fmt.Sprintf("%v overflows %s", v, t)))
+}
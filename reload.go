@@ -0,0 +1,310 @@
+package conf
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"time"
+)
+
+var (
+	ErrReload  = errors.New("reload err")
+	ErrPublish = errors.New("publish err")
+)
+
+// Metrics 加载配置的指标, 可以桥接到 Prometheus 等监控系统
+type Metrics interface {
+	// ObserveSourceParse 记录一个配置源解析并设置参数的耗时, source 为配置源的名称
+	ObserveSourceParse(source string, duration time.Duration)
+	// ObserveReload 记录一次 Parse 或 Reload 的结果, err 为空表示成功
+	ObserveReload(at time.Time, err error)
+}
+
+func WithMetrics(m Metrics) BuildFunc {
+	return func(x *X) {
+		x.metrics = m
+	}
+}
+
+// Stats 加载配置的统计信息, 包括 Parse 和 Reload
+type Stats struct {
+	Reloads             int64                    `json:"reloads"`
+	LastReload          time.Time                `json:"lastReload"`
+	LastReloadError     string                   `json:"lastReloadError,omitempty"`
+	SourceParseDuration map[string]time.Duration `json:"sourceParseDuration"`
+}
+
+// Stats 返回加载配置的统计信息
+func (x *X) Stats() Stats {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.statsCopy()
+}
+
+func (x *X) statsCopy() Stats {
+	ret := x.stats
+	ret.SourceParseDuration = make(map[string]time.Duration, len(x.stats.SourceParseDuration))
+	for name, duration := range x.stats.SourceParseDuration {
+		ret.SourceParseDuration[name] = duration
+	}
+	return ret
+}
+
+func (x *X) observeSource(source Source, duration time.Duration) {
+	name := sourceName(source)
+	x.stats.SourceParseDuration[name] = duration
+	if x.metrics != nil {
+		x.metrics.ObserveSourceParse(name, duration)
+	}
+}
+
+func (x *X) observeReload(start time.Time, err error) {
+	x.stats.Reloads++
+	if err != nil {
+		x.log(slog.LevelError, "config load failed", "reloads", x.stats.Reloads, "duration", time.Since(start), "err", err)
+	} else {
+		x.log(slog.LevelInfo, "config loaded", "reloads", x.stats.Reloads, "duration", time.Since(start), "profiles", x.Profiles())
+	}
+	x.stats.LastReload = start
+	x.stats.LastReloadError = ""
+	if err != nil {
+		x.stats.LastReloadError = err.Error()
+	}
+	if x.metrics != nil {
+		x.metrics.ObserveReload(start, err)
+	}
+}
+
+// Publish 将隐藏了敏感信息的配置和统计信息发布到 expvar, 同一个名称只能发布一次
+func (x *X) Publish(name string) error {
+	if expvar.Get(name) != nil {
+		return errors.Join(ErrPublish, errors.New(fmt.Sprintf("name %s already published", name)))
+	}
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		x.mu.RLock()
+		defer x.mu.RUnlock()
+		configs := make(map[string]interface{})
+		for _, config := range x.snapshot() {
+			configs[config.Key] = config.Value
+		}
+		return map[string]interface{}{
+			"configs": configs,
+			"stats":   x.statsCopy(),
+		}
+	}))
+	return nil
+}
+
+type argState struct {
+	value  interface{}
+	origin string
+}
+
+// Reload 重新解析所有配置源, 通过 Set 和 SetMany 修改的参数保持不变
+// 配置源解析到参数的副本中, 全部成功后才写回参数, 失败时参数保持不变并返回错误, 成功后对值变化的参数触发一次变更通知
+func (x *X) Reload() error {
+	x.mu.Lock()
+	changed, deferred, err := x.reload()
+	x.mu.Unlock()
+	// 释放锁之后再交给 handler, Metrics 和回调, 其中可以调用 Get, Stats 等方法
+	deferred.replay(x.handler, x.metrics)
+	if err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		x.notify(changed)
+	}
+	return nil
+}
+
+// reload 重新解析所有配置源并返回值变化的参数, 以及解析期间产生的结果和指标, 调用方需要持有 x.mu
+func (x *X) reload() ([]string, *deferred, error) {
+	deferred := &deferred{}
+	handler, metrics := x.handler, x.metrics
+	x.handler = deferred.handle
+	if metrics != nil {
+		x.metrics = deferred
+	}
+	defer func() {
+		x.handler, x.metrics = handler, metrics
+	}()
+	start := time.Now()
+	// 按照键排序, 结构体切片在元素之前
+	var keys []string
+	x.kv.Range(func(key string, _ Arg) bool {
+		keys = append(keys, key)
+		return true
+	})
+	sort.Strings(keys)
+	states := make(map[string]argState, len(keys))
+	for _, key := range keys {
+		arg, _ := x.kv.Get(key)
+		states[key] = argState{value: arg.GetValue(), origin: argOrigin(arg)}
+	}
+	// 解析期间注册的结构体中的字段保持不变
+	kv, slices := x.kv, x.slices
+	x.scratchArgs(keys)
+	err := x.collectErrors(false, x.parseSources)
+	scratch := x.kv
+	x.kv, x.slices = kv, slices
+	if err != nil {
+		err = errors.Join(ErrReload, err)
+		x.observeReload(start, err)
+		return nil, deferred, err
+	}
+	x.applyArgs(scratch)
+	x.flushSlices()
+	x.observeReload(start, nil)
+	var changed []string
+	x.kv.Range(func(key string, arg Arg) bool {
+		state, has := states[key]
+		if !has || !reflect.DeepEqual(state.value, arg.GetValue()) {
+			changed = append(changed, key)
+		}
+		return true
+	})
+	for _, key := range keys {
+		if _, has := x.kv.Get(key); !has {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed, deferred, nil
+}
+
+// scratchArgs 使用参数的副本替换 x.kv 和 x.slices, 通过 Set 修改的参数保持当前的值, 其他参数恢复为注册时的值
+// 结构体切片的副本没有元素, 元素在解析时通过下标创建
+func (x *X) scratchArgs(keys []string) {
+	kv := x.kv
+	x.kv = newKV[Arg]()
+	x.slices = nil
+	for _, key := range keys {
+		arg, _ := kv.Get(key)
+		// 元素由所在的结构体切片创建
+		if x.isElementKey(key) {
+			continue
+		}
+		set := argOrigin(arg) == OriginSet
+		if slice, ok := arg.(*StructSlice); ok {
+			v := reflect.New(slice.rValue.Type()).Elem()
+			scratch := newStructSlice(x, &v, newArgTree(slice.tree.key, ""), slice.path)
+			copyArgMeta(scratch, slice)
+			x.slices = append(x.slices, scratch)
+			x.kv.Set(key, scratch)
+			if set {
+				_ = scratch.SetValue(slice.GetValue())
+				scratch.Set()
+				setOrigin(scratch, OriginSet)
+			}
+			continue
+		}
+		scratch, err := x.scratchArg(arg, false)
+		if err != nil {
+			continue
+		}
+		if set {
+			scratch.Set()
+			setOrigin(scratch, OriginSet)
+		} else if state, ok := x.baseline[key]; ok {
+			_ = scratch.SetValue(state.value)
+			setOrigin(scratch, state.origin)
+		}
+		x.kv.Set(key, scratch)
+	}
+}
+
+func (x *X) isElementKey(key string) bool {
+	for _, slice := range x.slices {
+		if _, ok := slice.index(key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applyArgs 将解析成功的副本写回参数, 结构体切片先于元素写回
+func (x *X) applyArgs(scratch *kv[Arg]) {
+	var keys []string
+	scratch.Range(func(key string, _ Arg) bool {
+		keys = append(keys, key)
+		return true
+	})
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, _ := scratch.Get(key)
+		arg, has := x.lookupArg(key)
+		if !has {
+			continue
+		}
+		_ = arg.SetValue(value.GetValue())
+		setOrigin(arg, argOrigin(value))
+		if value.HasSet() {
+			arg.Set()
+		} else {
+			unsetArg(arg)
+		}
+	}
+}
+
+func unsetArg(arg Arg) {
+	if u, ok := arg.(interface{ unset() }); ok {
+		u.unset()
+	}
+}
+
+// deferred 记录持有锁期间产生的结果和指标, 释放锁之后再交给 handler 和 Metrics
+type deferred struct {
+	results []*ParseResult
+	metrics []func(m Metrics)
+}
+
+func (d *deferred) handle(result *ParseResult) {
+	d.results = append(d.results, result)
+}
+
+func (d *deferred) ObserveSourceParse(source string, duration time.Duration) {
+	d.metrics = append(d.metrics, func(m Metrics) {
+		m.ObserveSourceParse(source, duration)
+	})
+}
+
+func (d *deferred) ObserveReload(at time.Time, err error) {
+	d.metrics = append(d.metrics, func(m Metrics) {
+		m.ObserveReload(at, err)
+	})
+}
+
+func (d *deferred) replay(handler ConfigResultHandler, metrics Metrics) {
+	for _, result := range d.results {
+		handler(result)
+	}
+	if metrics == nil {
+		return
+	}
+	for _, observe := range d.metrics {
+		observe(metrics)
+	}
+}
+
+// collectErrors 执行 f 并返回期间通过 handler 报告的错误, forward 为 false 时错误不再交给 handler
+func (x *X) collectErrors(forward bool, f func()) error {
+	handler := x.handler
+	var errs []error
+	x.handler = func(result *ParseResult) {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+			if !forward {
+				return
+			}
+		}
+		handler(result)
+	}
+	defer func() {
+		x.handler = handler
+	}()
+	f()
+	return errors.Join(errs...)
+}
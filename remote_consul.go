@@ -0,0 +1,163 @@
+package conf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConsulKV 通过 Consul KV 的 HTTP API 读取配置, 实现 KVBackend
+// Watch 使用 blocking query, X-Consul-Index 变化时通知
+type ConsulKV struct {
+	// Address Consul 的地址, 例如 http://127.0.0.1:8500
+	Address string
+	// Token 通过 X-Consul-Token 传递, 为空时不传递
+	Token string
+	// Client List 使用的客户端, 为空时使用 http.DefaultClient, Watch 的请求会阻塞 WaitTime, 不使用 Client 的超时
+	Client *http.Client
+	// WaitTime blocking query 的最长等待时间, 为空时使用 5 分钟
+	WaitTime time.Duration
+	// RetryInterval Watch 请求失败或者没有阻塞就返回时的重试间隔, 为空时使用 1 秒
+	RetryInterval time.Duration
+}
+
+const (
+	defaultConsulWaitTime      = 5 * time.Minute
+	defaultConsulRetryInterval = time.Second
+)
+
+func NewConsulKV(address string) *ConsulKV {
+	return &ConsulKV{
+		Address:       strings.TrimSuffix(address, "/"),
+		Client:        &http.Client{Timeout: 10 * time.Second},
+		WaitTime:      defaultConsulWaitTime,
+		RetryInterval: defaultConsulRetryInterval,
+	}
+}
+
+type consulPair struct {
+	Key   string
+	Value []byte
+}
+
+func (c *ConsulKV) List(ctx context.Context, prefix string) ([]KVPair, error) {
+	pairs, _, err := c.list(ctx, c.client(), prefix, nil)
+	return pairs, err
+}
+
+// list 请求 /v1/kv/<prefix>?recurse, 返回键值以及 X-Consul-Index
+func (c *ConsulKV) list(ctx context.Context, client *http.Client, prefix string, query url.Values) ([]KVPair, uint64, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("recurse", "true")
+	u := c.Address + "/v1/kv/" + strings.TrimPrefix(prefix, "/") + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	// prefix 下没有键
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, index, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, 0, errors.New(fmt.Sprintf("consul %s: %s %s", u, resp.Status, strings.TrimSpace(string(body))))
+	}
+	var items []consulPair
+	err = json.NewDecoder(resp.Body).Decode(&items)
+	if err != nil {
+		return nil, 0, err
+	}
+	pairs := make([]KVPair, 0, len(items))
+	for _, item := range items {
+		pairs = append(pairs, KVPair{Key: item.Key, Value: item.Value})
+	}
+	return pairs, index, nil
+}
+
+// client 没有设置 Client 时使用 http.DefaultClient
+func (c *ConsulKV) client() *http.Client {
+	if c.Client == nil {
+		return http.DefaultClient
+	}
+	return c.Client
+}
+
+func (c *ConsulKV) waitTime() time.Duration {
+	if c.WaitTime <= 0 {
+		return defaultConsulWaitTime
+	}
+	return c.WaitTime
+}
+
+func (c *ConsulKV) retryInterval() time.Duration {
+	if c.RetryInterval <= 0 {
+		return defaultConsulRetryInterval
+	}
+	return c.RetryInterval
+}
+
+func (c *ConsulKV) Watch(ctx context.Context, prefix string) (<-chan struct{}, error) {
+	// 第一次请求获取当前的 index, 之后的变化才通知
+	_, index, err := c.list(ctx, c.client(), prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan struct{}, 1)
+	client := &http.Client{Transport: c.client().Transport}
+	go func() {
+		defer close(ch)
+		for ctx.Err() == nil {
+			query := url.Values{}
+			query.Set("index", strconv.FormatUint(index, 10))
+			query.Set("wait", fmt.Sprintf("%ds", int(c.waitTime()/time.Second)))
+			start := time.Now()
+			_, next, err := c.list(ctx, client, prefix, query)
+			if err != nil {
+				sleep(ctx, c.retryInterval())
+				continue
+			}
+			// 没有返回 index 或者 index 没有变化并且没有阻塞就返回时, 等待之后再请求, 避免不断地请求 Consul
+			if next == 0 || next == index && time.Since(start) < c.retryInterval() {
+				sleep(ctx, c.retryInterval())
+			}
+			switch {
+			// index 变小时需要重新开始, 参考 Consul 文档
+			case next < index:
+				index = 0
+			case next > index:
+				index = next
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// sleep 等待 d, ctx 结束时立即返回
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
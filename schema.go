@@ -0,0 +1,228 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/innsanes/conf/internal/yamlnode"
+	"gopkg.in/yaml.v3"
+)
+
+const jsonSchemaVersion = "https://json-schema.org/draft/2020-12/schema"
+
+var ErrJSONSchema = errors.New("json schema err")
+
+// JSONSchema 根据注册的参数生成描述 yaml 配置文件的 JSON Schema
+// 包括类型, 默认值, 描述, 以及标签中的 required, enum, min, max
+// 需要在 Parse 之后调用
+func (x *X) JSONSchema() ([]byte, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	root, err := x.schemaObject(x.argTree, []string{})
+	if err != nil {
+		return nil, errors.Join(ErrJSONSchema, err)
+	}
+	root.Content = append([]*yaml.Node{
+		scalarNode("$schema"), scalarNode(jsonSchemaVersion),
+	}, root.Content...)
+	buf := &bytes.Buffer{}
+	err = writeJsonNode(buf, root)
+	if err != nil {
+		return nil, errors.Join(ErrJSONSchema, err)
+	}
+	ret := &bytes.Buffer{}
+	err = json.Indent(ret, buf.Bytes(), "", "  ")
+	if err != nil {
+		return nil, errors.Join(ErrJSONSchema, err)
+	}
+	ret.WriteByte('\n')
+	return ret.Bytes(), nil
+}
+
+// schemaObject 生成 tree 对应的 object 类型的 schema, 保持注册顺序
+func (x *X) schemaObject(tree *argTree, prefix []string) (*yaml.Node, error) {
+	path := prefix
+	if tree.key != "" {
+		path = append(append([]string{}, prefix...), tree.key)
+	}
+	properties := &yaml.Node{Kind: yaml.MappingNode}
+	var required []string
+	for _, child := range tree.child {
+		var (
+			property *yaml.Node
+			err      error
+		)
+		switch {
+		case child.slice != nil:
+			tmp, elemTree := child.slice.example()
+			var items *yaml.Node
+			items, err = tmp.schemaObject(elemTree, []string{})
+			if err != nil {
+				return nil, err
+			}
+			property = &yaml.Node{Kind: yaml.MappingNode}
+			addPair(property, "type", scalarNode("array"))
+			if desc := child.slice.GetDescription(); desc != "" {
+				addPair(property, "description", scalarNode(desc))
+			}
+			addPair(property, "items", items)
+			schemaRule(property, child.slice, "array")
+		case len(child.child) == 0:
+			arg, has := x.kv.Get(strings.Join(append(append([]string{}, path...), child.key), "_"))
+			if !has {
+				continue
+			}
+			if argRule(arg).Required {
+				required = append(required, child.key)
+			}
+			property, err = schemaProperty(arg)
+		default:
+			property, err = x.schemaObject(child, path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		addPair(properties, child.key, property)
+	}
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	addPair(node, "type", scalarNode("object"))
+	addPair(node, "properties", properties)
+	if len(required) > 0 {
+		list := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, key := range required {
+			list.Content = append(list.Content, scalarNode(key))
+		}
+		addPair(node, "required", list)
+	}
+	return node, nil
+}
+
+// schemaProperty 生成参数的 schema
+func schemaProperty(arg Arg) (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	var (
+		kind  string
+		items *yaml.Node
+	)
+	switch a := arg.(type) {
+	case *Bool:
+		kind = "boolean"
+	case *Int, *Uint:
+		kind = "integer"
+	case *Float:
+		kind = "number"
+	case *String:
+		kind = "string"
+	case *ByteSizeArg:
+		addPair(node, "type", typeList("string", "integer"))
+		addPair(node, "format", scalarNode("byte-size"))
+	case *PercentArg:
+		addPair(node, "type", typeList("string", "number"))
+		addPair(node, "format", scalarNode("percent"))
+	case *Slice:
+		kind = "array"
+		elem := reflect.New(a.rValue.Type().Elem()).Elem()
+		var err error
+		items, err = schemaProperty(newScalarArg(&elem))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if kind != "" {
+		addPair(node, "type", scalarNode(kind))
+	}
+	if desc := arg.GetDescription(); desc != "" {
+		addPair(node, "description", scalarNode(desc))
+	}
+	// 敏感信息的默认值不输出
+	if arg.GetDefaultValue() != "" && !isSecret(arg) {
+		addPair(node, "default", defaultNode(arg))
+	}
+	if argRule(arg).Deprecated {
+		addPair(node, "deprecated", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+	}
+	if items != nil {
+		addPair(node, "items", items)
+	}
+	// 无符号整数的最小值为 0
+	if _, ok := arg.(*Uint); ok && argRule(arg).Min == nil {
+		addPair(node, "minimum", intNode(0))
+	}
+	schemaRule(node, arg, kind)
+	return node, nil
+}
+
+// schemaRule 将校验规则转换为 schema 的关键字, 切片的 enum 作用于元素
+func schemaRule(node *yaml.Node, arg Arg, kind string) {
+	rule := argRule(arg)
+	if len(rule.Enum) > 0 {
+		elemArg := arg
+		if a, ok := arg.(*Slice); ok {
+			elem := reflect.New(a.rValue.Type().Elem()).Elem()
+			elemArg = newScalarArg(&elem)
+		}
+		list := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range rule.Enum {
+			list.Content = append(list.Content, typedNode(elemArg, item))
+		}
+		if items := yamlnode.Value(node, "items"); kind == "array" && items != nil {
+			addPair(items, "enum", list)
+		} else {
+			addPair(node, "enum", list)
+		}
+	}
+	minKey, maxKey := "minimum", "maximum"
+	switch kind {
+	case "string":
+		minKey, maxKey = "minLength", "maxLength"
+	case "array":
+		minKey, maxKey = "minItems", "maxItems"
+	}
+	if rule.Min != nil {
+		setPair(node, minKey, floatNode(*rule.Min))
+	}
+	if rule.Max != nil {
+		setPair(node, maxKey, floatNode(*rule.Max))
+	}
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func intNode(value int) *yaml.Node {
+	node := &yaml.Node{}
+	_ = node.Encode(value)
+	return node
+}
+
+func floatNode(value float64) *yaml.Node {
+	node := &yaml.Node{}
+	_ = node.Encode(value)
+	return node
+}
+
+func typeList(kinds ...string) *yaml.Node {
+	list := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, kind := range kinds {
+		list.Content = append(list.Content, scalarNode(kind))
+	}
+	return list
+}
+
+func addPair(node *yaml.Node, key string, value *yaml.Node) {
+	node.Content = append(node.Content, scalarNode(key), value)
+}
+
+// setPair 设置 mapping 中键的值, 键不存在时添加
+func setPair(node *yaml.Node, key string, value *yaml.Node) {
+	index := yamlnode.Index(node, key)
+	if index < 0 {
+		addPair(node, key, value)
+		return
+	}
+	node.Content[index+1] = value
+}
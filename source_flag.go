@@ -4,12 +4,25 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 )
 
+// 布尔参数取反的前缀, 例如 --no-t_debug
+const negationPrefix = "no-"
+
+var ErrFlagParse = errors.New("parse flag err")
+
 type Flag struct {
 	*kv[interface{}]
 	args []string
 	conf *X
+	// 解析完成后剩余的位置参数, 包括 -- 之后的所有参数
+	positional []string
+	// 通过 NewFlagWithArgs 或 SetArgs 指定的参数, 未指定时使用 os.Args[1:]
+	input    []string
+	hasInput bool
+	// 本次解析是否已经处理过子命令, Reload 时子命令已经选中, 不再重复注册
+	dispatched bool
 }
 
 func NewFlag(conf *X) *Flag {
@@ -19,8 +32,35 @@ func NewFlag(conf *X) *Flag {
 	}
 }
 
+// NewFlagWithArgs 从指定的参数中解析, args 不包含程序名称
+func NewFlagWithArgs(conf *X, args []string) *Flag {
+	f := NewFlag(conf)
+	f.SetArgs(args)
+	return f
+}
+
+// SetArgs 指定需要解析的参数, args 不包含程序名称
+func (f *Flag) SetArgs(args []string) {
+	f.input = append([]string{}, args...)
+	f.hasInput = true
+}
+
+func (f *Flag) Name() string {
+	return "flag"
+}
+
+// inputArgs 返回需要解析的参数
+func (f *Flag) inputArgs() []string {
+	if f.hasInput {
+		return append([]string{}, f.input...)
+	}
+	return append([]string{}, os.Args[1:]...)
+}
+
 func (f *Flag) Parse() {
-	f.args = os.Args[1:]
+	f.kv = newKV[interface{}]()
+	f.dispatched = false
+	f.args = f.inputArgs()
 	for {
 		seen, err := f.parseOne()
 		if seen {
@@ -29,7 +69,85 @@ func (f *Flag) Parse() {
 		if err == nil {
 			break
 		}
-		f.conf.panic("parse flag err:%s", err)
+		if errors.Is(err, ErrHelp) {
+			f.conf.PrintUsage(os.Stderr)
+			f.conf.helpRequested = true
+			f.conf.handler(NewParseResultError(ErrHelp))
+			return
+		}
+		// 未定义的参数, 未知的子命令等错误交给 handler, 没有指定 handler 时仍然退出
+		f.conf.handler(NewParseResultError(ErrFlagParse, err))
+		return
+	}
+	// 剩余的位置参数
+	f.positional = f.args
+	f.conf.commandArgs = f.args
+	f.bindPositional()
+}
+
+// commandName 返回第一个位置参数, 用于在解析配置源之前选中子命令
+// 只跳过参数的值, 不设置参数, 没有值的参数只有布尔参数
+func (f *Flag) commandName() string {
+	args := f.inputArgs()
+	for i := 0; i < len(args); i++ {
+		s := args[i]
+		if len(s) < 2 || s[0] != '-' {
+			return s
+		}
+		name := strings.TrimLeft(s, "-")
+		if s == "--" || name == "h" || name == "help" {
+			return ""
+		}
+		if strings.Contains(name, "=") {
+			continue
+		}
+		// 布尔参数以及 -no-<key> 的形式没有值
+		arg, _ := f.conf.kv.Get(name)
+		negation, _ := f.conf.kv.Get(strings.TrimPrefix(name, negationPrefix))
+		_, isBool := arg.(*Bool)
+		_, isNegation := negation.(*Bool)
+		if isBool || isNegation {
+			continue
+		}
+		// 参数的值
+		i++
+	}
+	return ""
+}
+
+// Args 返回解析完成后剩余的位置参数
+func (f *Flag) Args() []string {
+	return f.positional
+}
+
+// NArg 返回剩余的位置参数的数量
+func (f *Flag) NArg() int {
+	return len(f.positional)
+}
+
+// Arg 返回第 i 个位置参数, 不存在时返回空
+func (f *Flag) Arg(i int) string {
+	if i < 0 || i >= len(f.positional) {
+		return ""
+	}
+	return f.positional[i]
+}
+
+// bindPositional 将位置参数设置到 pos 标签绑定的参数中, 切片绑定该下标之后的所有参数
+func (f *Flag) bindPositional() {
+	for _, pos := range f.conf.positions {
+		if pos.index >= len(f.positional) {
+			continue
+		}
+		arg, has := f.conf.kv.Get(pos.key)
+		if !has {
+			continue
+		}
+		if _, ok := arg.(*Slice); ok {
+			f.Set(pos.key, f.positional[pos.index:])
+			continue
+		}
+		f.Set(pos.key, f.positional[pos.index])
 	}
 }
 
@@ -40,6 +158,18 @@ func (f *Flag) parseOne() (bool, error) {
 	}
 	s := f.args[0]
 	if len(s) < 2 || s[0] != '-' {
+		// 第一个位置参数作为子命令
+		if f.conf.hasCommands() && !f.dispatched {
+			if f.conf.command == "" {
+				err := f.conf.selectCommand(s)
+				if err != nil {
+					return false, err
+				}
+			}
+			f.dispatched = true
+			f.args = f.args[1:]
+			return true, nil
+		}
 		return false, nil
 	}
 	numMinuses := 1
@@ -68,7 +198,22 @@ func (f *Flag) parseOne() (bool, error) {
 		}
 	}
 
-	r, has := f.conf.kv.Get(name)
+	r, has := f.conf.lookupArg(name)
+	if !has && (name == "h" || name == "help") {
+		return false, ErrHelp
+	}
+	// 布尔参数支持 -no-<key> 的形式设置为 false
+	if !has && strings.HasPrefix(name, negationPrefix) {
+		key := name[len(negationPrefix):]
+		negation, ok := f.conf.kv.Get(key)
+		if _, isBool := negation.(*Bool); ok && isBool {
+			if hasValue {
+				return false, errors.New(fmt.Sprintf("flag does not take an argument: -%s", name))
+			}
+			f.Set(key, "false")
+			return true, nil
+		}
+	}
 	if !has {
 		// 没有类型无法解析
 		return false, errors.New(fmt.Sprintf("flag provided but not defined: -%s", name))
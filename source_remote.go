@@ -0,0 +1,195 @@
+package conf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrRemoteLoad  = errors.New("remote load err")
+	ErrRemoteWatch = errors.New("remote watch err")
+)
+
+// KVPair 远程存储中的一个键值
+type KVPair struct {
+	Key   string
+	Value []byte
+}
+
+// KVBackend 远程键值存储, 例如 Consul KV, etcd
+type KVBackend interface {
+	// List 返回 prefix 下所有的键值
+	List(ctx context.Context, prefix string) ([]KVPair, error)
+	// Watch 监听 prefix 下的变化, 每次变化向通道发送一次, ctx 结束后关闭通道
+	Watch(ctx context.Context, prefix string) (<-chan struct{}, error)
+}
+
+// RemoteSource 从远程键值存储读取配置
+// 去掉 prefix 后键中的 / 替换为 _, 例如 prefix 为 app/ 时 app/t/port -> t_port
+// 值为 yaml 的 map 或 map 的列表时展开, 例如 app/t/upstreams 的值为 "- host: a" -> t_upstreams_0_host
+type RemoteSource struct {
+	*kv[interface{}]
+	conf    *X
+	backend KVBackend
+	prefix  string
+	// 参数对应的远程键, 用于错误信息
+	locations map[string]string
+}
+
+func NewRemoteSource(conf *X, backend KVBackend, prefix string) *RemoteSource {
+	return &RemoteSource{
+		kv:        newKV[interface{}](),
+		conf:      conf,
+		backend:   backend,
+		prefix:    prefix,
+		locations: make(map[string]string),
+	}
+}
+
+func (r *RemoteSource) Name() string {
+	return "remote"
+}
+
+// Location 返回参数对应的远程键, 展开的参数返回所在的远程键
+func (r *RemoteSource) Location(key string) string {
+	return r.locations[key]
+}
+
+func (r *RemoteSource) Parse() {
+	// 重新解析时清空上一次的结果
+	r.kv = newKV[interface{}]()
+	r.locations = make(map[string]string)
+	pairs, err := r.backend.List(context.Background(), r.prefix)
+	if err != nil {
+		r.conf.handler(NewParseResultError(ErrRemoteLoad, errors.New(fmt.Sprintf("prefix:%s", r.prefix)), err))
+		return
+	}
+	for _, pair := range pairs {
+		key := strings.Trim(strings.TrimPrefix(pair.Key, r.prefix), "/")
+		// 目录没有值
+		if key == "" || strings.HasSuffix(pair.Key, "/") {
+			continue
+		}
+		key = strings.ReplaceAll(key, "/", "_")
+		set := func(key string, value interface{}) {
+			r.Set(key, value)
+			r.locations[key] = pair.Key
+		}
+		if data, ok := remoteCollection(pair.Value); ok {
+			flattenMap(map[string]interface{}{key: data}, "", set)
+			continue
+		}
+		set(key, string(pair.Value))
+	}
+}
+
+// remoteCollection 值为 yaml 的 map 或 map 的列表时返回解析后的值, 其他的值作为字符串
+func remoteCollection(value []byte) (interface{}, bool) {
+	var data interface{}
+	if yaml.Unmarshal(value, &data) != nil {
+		return nil, false
+	}
+	switch v := data.(type) {
+	case map[string]interface{}:
+		return v, true
+	case []interface{}:
+		if isMapSlice(v) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// Watch 监听远程存储的变化, 有变化时调用 X.Reload 直到 ctx 结束
+// Reload 的错误记录在 X.Stats 中, 并通过 logger 输出
+func (r *RemoteSource) Watch(ctx context.Context) error {
+	ch, err := r.backend.Watch(ctx, r.prefix)
+	if err != nil {
+		return errors.Join(ErrRemoteWatch, err)
+	}
+	go func() {
+		for range ch {
+			_ = r.conf.Reload()
+		}
+	}()
+	return nil
+}
+
+// MemoryKV 内存中的 KVBackend, 用于测试
+type MemoryKV struct {
+	mu       sync.Mutex
+	data     map[string][]byte
+	watchers map[chan struct{}]string
+}
+
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{
+		data:     make(map[string][]byte),
+		watchers: make(map[chan struct{}]string),
+	}
+}
+
+// Put 设置键值, 并通知监听该键的 Watch
+func (m *MemoryKV) Put(key string, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = []byte(value)
+	m.notify(key)
+}
+
+// Delete 删除键, 并通知监听该键的 Watch
+func (m *MemoryKV) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	m.notify(key)
+}
+
+func (m *MemoryKV) notify(key string) {
+	for ch, prefix := range m.watchers {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		// 已经有未处理的通知时不再发送
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (m *MemoryKV) List(ctx context.Context, prefix string) ([]KVPair, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pairs []KVPair
+	for key, value := range m.data {
+		if strings.HasPrefix(key, prefix) {
+			pairs = append(pairs, KVPair{Key: key, Value: append([]byte{}, value...)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Key < pairs[j].Key
+	})
+	return pairs, nil
+}
+
+func (m *MemoryKV) Watch(ctx context.Context, prefix string) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+	m.mu.Lock()
+	m.watchers[ch] = prefix
+	m.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		delete(m.watchers, ch)
+		close(ch)
+		m.mu.Unlock()
+	}()
+	return ch, nil
+}
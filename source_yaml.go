@@ -1,76 +1,545 @@
 package conf
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
 	"gopkg.in/yaml.v3"
 )
 
+var (
+	ErrYamlLoad         = errors.New("yaml load err")
+	ErrYamlIncludeCycle = errors.New("yaml include cycle")
+	ErrYamlGenerate     = errors.New("yaml generate err")
+)
+
+const (
+	// yaml 中引用其他文件的标签, 例如 db: !include db.yaml
+	yamlIncludeTag = "!include"
+	// yaml 顶层引用其他文件的键, 例如 include: [base.yaml, region.yaml]
+	yamlIncludeKey = "include"
+	// yaml 顶层按环境覆盖配置的键, 例如 profiles: {prod: {...}}
+	yamlProfilesKey = "profiles"
+	// FilePath 为 - 时从标准输入读取
+	yamlStdin = "-"
+)
+
 type Yaml struct {
 	YamlConf *YamlConf
 	*kv[interface{}]
-	conf *X
+	conf     *X
+	fileMode os.FileMode
+	// 参数在文件中的位置, 用于错误信息
+	locations map[string]string
+	// 通过 NewYamlWithFS 指定的文件系统, 为 nil 时读取本地文件
+	fsys fs.FS
+	// FilePath 为 - 时读取的内容, 为 nil 时读取标准输入, 只读取一次, Reload 时使用第一次读取的内容
+	stdin     io.Reader
+	stdinData []byte
+	stdinRead bool
+	// 通过 NewYamlWithReader 或 NewYamlWithBytes 创建时忽略 FilePath
+	readerOnly bool
+	// 配置源的名称, 通过 NewYamlWithDecoder 创建时为其他格式的名称
+	name string
+	// 通过 NewYamlWithDecoder 指定的解码器, 为 nil 时按照 yaml 解析
+	decoder Decoder
 }
 
+// Decoder 将其他格式的文件解码为 map, lines 为键所在的行号, 键使用 _ 连接, 例如 t_upstreams_0_host
+type Decoder func(content []byte) (data map[string]interface{}, lines map[string]int, err error)
+
 type YamlConf struct {
-	FilePath string `conf:"filepath,default=config.yaml"`
+	// 多个文件用逗号分隔, 支持 glob 匹配, 按顺序合并, 后面的覆盖前面的
+	FilePath string `conf:"filepath,default=config.yaml,usage=yaml file list separated by comma and glob supported"`
+	// 激活的环境, 多个环境用逗号分隔, 为空时使用 X.Profiles()
+	Profile string `conf:"profile,usage=active profiles separated by comma"`
 }
 
 func NewYaml(conf *X) *Yaml {
 	return &Yaml{
-		YamlConf: &YamlConf{},
-		kv:       newKV[interface{}](),
-		conf:     conf,
+		YamlConf:  &YamlConf{},
+		kv:        newKV[interface{}](),
+		conf:      conf,
+		fileMode:  0644,
+		locations: make(map[string]string),
+		name:      "yaml",
+	}
+}
+
+// NewYamlWithReader 从 r 读取配置, 例如管道传入的配置, 忽略 FilePath, 位置信息中的文件名为 -
+func NewYamlWithReader(conf *X, r io.Reader) *Yaml {
+	y := NewYaml(conf)
+	y.stdin = r
+	y.readerOnly = true
+	return y
+}
+
+// NewYamlWithBytes 从 data 读取配置, 例如通过 go:embed 嵌入的配置
+func NewYamlWithBytes(conf *X, data []byte) *Yaml {
+	return NewYamlWithReader(conf, bytes.NewReader(data))
+}
+
+// NewYamlWithFS 从 fsys 中读取 FilePath 指定的文件, 例如 embed.FS, 路径使用 / 分隔
+// 文件不存在时不会生成模板
+func NewYamlWithFS(conf *X, fsys fs.FS) *Yaml {
+	y := NewYaml(conf)
+	y.fsys = fsys
+	return y
+}
+
+// NewYamlWithDecoder 使用 decoder 读取 FilePath 指定的其他格式的文件, 例如 toml, name 为配置源的名称
+// 多个文件, glob, profiles 以及 config.<profile>.<ext> 的处理与 yaml 相同, 不支持 include, 文件不存在时不会生成模板
+func NewYamlWithDecoder(conf *X, name string, decoder Decoder) *Yaml {
+	y := NewYaml(conf)
+	y.name = name
+	y.decoder = decoder
+	return y
+}
+
+func (y *Yaml) Name() string {
+	return y.name
+}
+
+// Location 返回参数在文件中的位置, 参数本身没有记录时返回最近的上级位置
+func (y *Yaml) Location(key string) string {
+	for {
+		if location, has := y.locations[key]; has {
+			return location
+		}
+		index := strings.LastIndex(key, "_")
+		if index < 0 {
+			return ""
+		}
+		key = key[:index]
 	}
 }
 
 func (y *Yaml) Parse() {
-	// 判断文件是否存在, 如果存在则读取, 如果不存在就创建文件
-	if !y.conf.fileExist(y.YamlConf.FilePath) {
-		y.format()
+	// 重新解析时清空上一次的结果
+	y.kv = newKV[interface{}]()
+	y.locations = make(map[string]string)
+	paths := y.paths()
+	// 只配置了一个本地文件且文件不存在时, 按照参数列表生成文件
+	if len(paths) == 1 && paths[0] != yamlStdin && y.fsys == nil && y.decoder == nil && !hasGlobMeta(paths[0]) && !y.conf.fileExist(paths[0]) {
+		y.format(paths[0])
 		return
 	}
-	// 将文件中的yaml数据解析成map
-	binaryData := y.conf.readFile(y.YamlConf.FilePath)
-	var data map[string]interface{}
-	err := yaml.Unmarshal(binaryData, &data)
+	files, err := expandFiles(paths, y.glob)
 	if err != nil {
-		y.conf.panic("yaml unmarshal err:%s", err)
+		y.conf.handler(NewParseResultError(ErrYamlLoad, err))
+		return
+	}
+	if y.YamlConf.Profile != "" {
+		y.conf.SetProfile(splitList(y.YamlConf.Profile)...)
+	}
+	profiles := y.conf.Profiles()
+	// 按顺序加载所有文件并合并, 每个文件先合并文件中 profiles 下对应环境的配置, 再合并对应环境的文件 config.<profile>.yaml
+	data := make(map[string]interface{})
+	for _, file := range files {
+		overlays := []string{file}
+		for _, profile := range profiles {
+			overlay := profileFile(file, profile)
+			if file != yamlStdin && y.exist(overlay) {
+				overlays = append(overlays, overlay)
+			}
+		}
+		for _, overlay := range overlays {
+			v, err := y.load(overlay, nil)
+			if err != nil {
+				y.conf.handler(NewParseResultError(err))
+				return
+			}
+			if m, ok := v.(map[string]interface{}); ok {
+				y.applyProfiles(m, profiles)
+				mergeMap(data, m)
+			}
+		}
 	}
 	y.yamlRecursiveParse(data, "")
 }
 
-func (y *Yaml) yamlRecursiveParse(data map[string]interface{}, prefix string) {
-	for key, v := range data {
-		// 判断value是否是map, 如果是继续递归, 如果不是, 存入KV中
-		if subData, ok := v.(map[string]interface{}); ok {
-			y.yamlRecursiveParse(subData, prefix+key+"_")
+// applyProfiles 将文件中 profiles 下对应环境的配置合并到文件的顶层, 并记录参数的位置
+func (y *Yaml) applyProfiles(data map[string]interface{}, profiles []string) {
+	section, ok := data[yamlProfilesKey].(map[string]interface{})
+	if !ok {
+		return
+	}
+	delete(data, yamlProfilesKey)
+	for _, profile := range profiles {
+		m, ok := section[profile].(map[string]interface{})
+		if !ok {
 			continue
 		}
-		y.Set(prefix+key, v)
+		mergeMap(data, m)
+		prefix := yamlProfilesKey + "_" + profile + "_"
+		for key, location := range y.locations {
+			if strings.HasPrefix(key, prefix) {
+				y.locations[strings.TrimPrefix(key, prefix)] = location
+			}
+		}
 	}
 }
 
-func (y *Yaml) format() {
-	// 将 conf 中的tree数据转成 map 并将其写入文件中
-	// 1. 将tree数据转成map
-	data := make(map[string]interface{})
-	y.yamlRecursiveFormat(y.conf.argTree, data)
-	// 2. 将map数据转成yaml
-	binaryData, err := yaml.Marshal(data)
+// paths 返回需要读取的文件, 通过 reader 创建时只读取 reader
+func (y *Yaml) paths() []string {
+	if y.readerOnly {
+		return []string{yamlStdin}
+	}
+	return splitList(y.YamlConf.FilePath)
+}
+
+// readFile 读取文件, - 读取标准输入或者 reader, 设置了 fs.FS 时从 fs.FS 中读取
+func (y *Yaml) readFile(file string) ([]byte, error) {
+	switch {
+	case file == yamlStdin:
+		if !y.stdinRead {
+			var r = y.stdin
+			if r == nil {
+				r = os.Stdin
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+			y.stdinData, y.stdinRead = data, true
+		}
+		return y.stdinData, nil
+	case y.fsys != nil:
+		return fs.ReadFile(y.fsys, file)
+	}
+	return os.ReadFile(file)
+}
+
+func (y *Yaml) exist(file string) bool {
+	if y.fsys == nil {
+		return y.conf.fileExist(file)
+	}
+	_, err := fs.Stat(y.fsys, file)
+	return err == nil
+}
+
+// glob 返回匹配的文件, 其他匹配文件的环境文件不作为基础文件加载, 例如同时匹配 config.yaml 和 config.prod.yaml 时只返回 config.yaml
+// 激活的环境文件在加载 config.yaml 之后合并
+func (y *Yaml) glob(pattern string) ([]string, error) {
+	var (
+		matches []string
+		err     error
+	)
+	if y.fsys == nil {
+		matches, err = filepath.Glob(pattern)
+	} else {
+		matches, err = fs.Glob(y.fsys, pattern)
+	}
+	if err != nil {
+		return nil, err
+	}
+	bases := make(map[string]bool, len(matches))
+	for _, match := range matches {
+		bases[match] = true
+	}
+	var ret []string
+	for _, match := range matches {
+		if !isProfileFile(match, bases) {
+			ret = append(ret, match)
+		}
+	}
+	return ret, nil
+}
+
+// isProfileFile 判断 file 是否为 bases 中某个文件的环境文件, 例如 config.prod.yaml 是 config.yaml 的环境文件
+func isProfileFile(file string, bases map[string]bool) bool {
+	ext := filepath.Ext(file)
+	name := strings.TrimSuffix(file, ext)
+	index := strings.LastIndex(name, ".")
+	if index < 0 || strings.ContainsAny(name[index:], `/\`) {
+		return false
+	}
+	return bases[name[:index]+ext]
+}
+
+// abs 返回用于检测循环引用的路径, fs.FS 中的路径已经是相对于根目录的
+func (y *Yaml) abs(file string) string {
+	if y.fsys != nil {
+		return path.Clean(file)
+	}
+	abs, err := filepath.Abs(file)
 	if err != nil {
-		y.conf.panic("yaml marshal err:%s", err)
+		return file
+	}
+	return abs
+}
+
+// dir 返回文件所在的目录, fs.FS 中的路径总是使用 / 分隔
+func (y *Yaml) dir(file string) string {
+	if y.fsys != nil {
+		return path.Dir(file)
 	}
-	// 3. 将yaml写入文件
-	y.conf.writeFile(y.YamlConf.FilePath, binaryData)
+	return filepath.Dir(file)
 }
 
-func (y *Yaml) yamlRecursiveFormat(tree *argTree, data map[string]interface{}) {
-	for _, child := range tree.child {
-		if len(child.child) == 0 {
-			data[child.key] = child.value
+// includePath 返回引用的文件相对于 dir 的路径, fs.FS 中没有绝对路径
+func (y *Yaml) includePath(dir string, file string) string {
+	if y.fsys != nil {
+		return path.Join(dir, file)
+	}
+	return relativePath(dir, file)
+}
+
+// profileFile 返回环境对应的文件路径, 例如 config.yaml -> config.prod.yaml
+func profileFile(file string, profile string) string {
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "." + profile + ext
+}
+
+// load 读取并解析一个yaml文件, 处理其中的 !include 标签和 include 键
+// chain 为当前的引用链, 用于检测循环引用以及输出错误信息
+func (y *Yaml) load(file string, chain []string) (interface{}, error) {
+	abs := y.abs(file)
+	for _, f := range chain {
+		if f == abs {
+			return nil, errors.Join(ErrYamlIncludeCycle,
+				errors.New(strings.Join(append(chain, abs), " -> ")),
+			)
+		}
+	}
+	chain = append(chain, abs)
+	if y.decoder != nil {
+		return y.decode(file, chain)
+	}
+
+	binaryData, err := y.readFile(file)
+	if err != nil {
+		return nil, errors.Join(ErrYamlLoad, chainError(chain, err))
+	}
+	var node yaml.Node
+	err = yaml.Unmarshal(binaryData, &node)
+	if err != nil {
+		return nil, errors.Join(ErrYamlLoad, chainError(chain, err))
+	}
+	// 空文件
+	if node.Kind == 0 {
+		return nil, nil
+	}
+	// 处理 !include 标签, 路径相对于当前文件
+	err = y.resolveIncludeTag(&node, y.dir(file), chain)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	err = node.Decode(&data)
+	if err != nil {
+		return nil, errors.Join(ErrYamlLoad, chainError(chain, err))
+	}
+
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return data, nil
+	}
+	// 处理顶层 include 键, 先合并被引用的文件, 再用当前文件覆盖
+	include, has := m[yamlIncludeKey]
+	if !has {
+		y.recordLocations(node.Content[0], "", file)
+		return m, nil
+	}
+	delete(m, yamlIncludeKey)
+	var includes []string
+	switch v := include.(type) {
+	case string:
+		includes = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			includes = append(includes, fmt.Sprint(item))
+		}
+	default:
+		return nil, errors.Join(ErrYamlLoad, chainError(chain,
+			errors.New(fmt.Sprintf("invalid %s value %v", yamlIncludeKey, include)),
+		))
+	}
+	ret := make(map[string]interface{})
+	for _, path := range includes {
+		sub, err := y.load(y.includePath(y.dir(file), path), chain)
+		if err != nil {
+			return nil, err
+		}
+		if subMap, ok := sub.(map[string]interface{}); ok {
+			mergeMap(ret, subMap)
+		}
+	}
+	mergeMap(ret, m)
+	y.recordLocations(node.Content[0], "", file)
+	return ret, nil
+}
+
+// decode 通过 decoder 读取一个文件并记录参数的位置, 解码的错误保持 decoder 返回的类型
+func (y *Yaml) decode(file string, chain []string) (interface{}, error) {
+	binaryData, err := y.readFile(file)
+	if err != nil {
+		return nil, errors.Join(ErrReadFile, chainError(chain, err))
+	}
+	data, lines, err := y.decoder(binaryData)
+	if err != nil {
+		return nil, errors.Join(err, errors.New(fmt.Sprintf("file:%s", file)))
+	}
+	for key, line := range lines {
+		y.locations[key] = fmt.Sprintf("%s:%d", file, line)
+	}
+	return data, nil
+}
+
+// recordLocations 记录 mapping 节点中每个键所在的文件和行号
+func (y *Yaml) recordLocations(node *yaml.Node, prefix string, file string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, value := node.Content[i], node.Content[i+1]
+		key := prefix + keyNode.Value
+		// 被 !include 替换的节点没有行号
+		if keyNode.Line > 0 {
+			y.locations[key] = fmt.Sprintf("%s:%d", file, keyNode.Line)
+		}
+		y.recordLocations(value, key+"_", file)
+		// 元素为 map 的切片按下标记录
+		if value.Kind == yaml.SequenceNode {
+			for index, item := range value.Content {
+				y.recordLocations(item, fmt.Sprintf("%s_%d_", key, index), file)
+			}
+		}
+	}
+}
+
+func (y *Yaml) resolveIncludeTag(node *yaml.Node, dir string, chain []string) error {
+	if node.Kind == yaml.ScalarNode && node.Tag == yamlIncludeTag {
+		sub, err := y.load(y.includePath(dir, node.Value), chain)
+		if err != nil {
+			return err
+		}
+		var subNode yaml.Node
+		err = subNode.Encode(sub)
+		if err != nil {
+			return errors.Join(ErrYamlLoad, chainError(chain, err))
+		}
+		*node = subNode
+		return nil
+	}
+	for _, child := range node.Content {
+		err := y.resolveIncludeTag(child, dir, chain)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (y *Yaml) yamlRecursiveParse(data map[string]interface{}, prefix string) {
+	// map 继续展开, 元素为 map 的切片按下标展开, 其他的存入KV中
+	flattenMap(data, prefix, func(key string, value interface{}) {
+		y.Set(key, value)
+	})
+}
+
+func (y *Yaml) format(filepath string) {
+	// 根据参数列表生成 yaml 并写入文件
+	buf := &bytes.Buffer{}
+	err := y.Generate(buf)
+	if err != nil {
+		y.conf.handler(NewParseResultError(ErrYamlGenerate, err))
+		return
+	}
+	y.conf.writeFile(filepath, buf.Bytes(), y.fileMode)
+}
+
+// SetFileMode 设置生成 yaml 文件时使用的权限, 默认为 0644
+func (y *Yaml) SetFileMode(mode os.FileMode) {
+	y.fileMode = mode
+}
+
+// Generate 根据注册的参数生成 yaml 配置模板, 值为参数的默认值并保持参数类型
+// 参数的描述作为注释, 顺序与结构体字段顺序一致
+func (y *Yaml) Generate(w io.Writer) error {
+	node, err := y.skeleton()
+	if err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	err = encoder.Encode(node)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func (y *Yaml) skeleton() (*yaml.Node, error) {
+	return y.conf.yamlNode(y.conf.argTree, []string{}, true, func(arg Arg) (*yaml.Node, error) {
+		return defaultNode(arg), nil
+	})
+}
+
+// defaultNode 根据参数类型将默认值转换为对应类型的 yaml 节点
+func defaultNode(arg Arg) *yaml.Node {
+	return typedNode(arg, arg.GetDefaultValue())
+}
+
+// typedNode 根据参数类型将字符串转换为对应类型的 yaml 节点
+func typedNode(arg Arg, value string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+	switch arg.(type) {
+	case *Int, *Uint:
+		node.Tag = "!!int"
+		if value == "" {
+			node.Value = "0"
+		}
+	case *Float:
+		node.Tag = "!!float"
+		if value == "" {
+			node.Value = "0"
+		}
+	case *Bool:
+		node.Tag = "!!bool"
+		if value == "" {
+			node.Value = "false"
+		}
+	case *ByteSizeArg:
+		if value == "" {
+			node.Value = ByteSize(0).String()
+		}
+	case *PercentArg:
+		if value == "" {
+			node.Value = Percent(0).String()
+		}
+	case *Slice:
+		node = &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range strings.Split(value, "|") {
+			if item == "" {
+				continue
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: item})
+		}
+	}
+	return node
+}
+
+// mergeMap 将 src 深度合并到 dst 中, 相同的键 src 覆盖 dst
+func mergeMap(dst, src map[string]interface{}) {
+	for key, v := range src {
+		srcSub, ok1 := v.(map[string]interface{})
+		dstSub, ok2 := dst[key].(map[string]interface{})
+		if ok1 && ok2 {
+			mergeMap(dstSub, srcSub)
 			continue
 		}
-		subData := make(map[string]interface{})
-		data[child.key] = subData
-		y.yamlRecursiveFormat(child, subData)
+		dst[key] = v
 	}
 }
+
+func chainError(chain []string, err error) error {
+	return errors.New(fmt.Sprintf("%s: %s", strings.Join(chain, " -> "), err))
+}
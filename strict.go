@@ -0,0 +1,151 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// StrictMode 配置源中出现未注册参数时的处理方式
+type StrictMode int
+
+const (
+	// StrictOff 忽略未注册的参数
+	StrictOff StrictMode = iota
+	// StrictWarn 通过 handler 输出警告
+	StrictWarn
+	// StrictError 通过 handler 返回错误
+	StrictError
+)
+
+var ErrUnknownKey = errors.New("unknown key")
+
+func WithStrict(mode StrictMode) BuildFunc {
+	return func(x *X) {
+		x.strict = mode
+	}
+}
+
+type unknownKey struct {
+	key      string
+	source   string
+	location string
+}
+
+// addUnknown 记录配置源中未注册的参数
+func (x *X) addUnknown(source Source, key string) {
+	unknown := unknownKey{
+		key:    key,
+		source: sourceName(source),
+	}
+	if locator, ok := source.(SourceLocator); ok {
+		unknown.location = locator.Location(key)
+	}
+	x.addUnknownKey(unknown)
+}
+
+// addUnknownKey 记录未注册的参数, 同一个配置源中的参数只记录一次
+func (x *X) addUnknownKey(unknown unknownKey) {
+	if x.strict == StrictOff {
+		return
+	}
+	for _, recorded := range x.unknown {
+		if recorded.key == unknown.key && recorded.source == unknown.source {
+			return
+		}
+	}
+	x.unknown = append(x.unknown, unknown)
+}
+
+// reportUnknown 通过 handler 报告所有未注册的参数
+func (x *X) reportUnknown() {
+	if x.strict == StrictOff || len(x.unknown) == 0 {
+		return
+	}
+	var messages []string
+	for _, unknown := range x.unknown {
+		message := fmt.Sprintf("unknown key %s from %s", unknown.key, unknown.source)
+		if unknown.location != "" {
+			message += fmt.Sprintf(" (%s)", unknown.location)
+		}
+		suggest := x.suggestKey(unknown.key)
+		if suggest != "" {
+			message += fmt.Sprintf(", did you mean %s?", suggest)
+		}
+		x.log(slog.LevelWarn, "config unknown key", "key", unknown.key, "source", unknown.source,
+			"location", unknown.location, "suggest", suggest)
+		messages = append(messages, message)
+	}
+	x.unknown = nil
+	if x.strict == StrictWarn {
+		x.handler(NewParseResultWarning(messages...))
+		return
+	}
+	x.handler(NewParseResultError(ErrUnknownKey, errors.New(strings.Join(messages, "\n"))))
+}
+
+// suggestKey 返回与 key 编辑距离最近的已注册参数, 距离过大时返回空
+func (x *X) suggestKey(key string) string {
+	var (
+		suggest string
+		best    = len(key)/2 + 1
+	)
+	x.kv.Range(func(registered string, _ Arg) bool {
+		distance := levenshtein(key, registered)
+		if distance < best || distance == best && suggest != "" && registered < suggest {
+			best = distance
+			suggest = registered
+		}
+		return true
+	})
+	return suggest
+}
+
+func sourceName(source Source) string {
+	if named, ok := source.(NamedSource); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", source)
+}
+
+// sourceOrigin 返回参数来源的描述, 例如 yaml (config.yaml:3)
+func sourceOrigin(source Source, key string) string {
+	origin := sourceName(source)
+	if locator, ok := source.(SourceLocator); ok {
+		if location := locator.Location(key); location != "" {
+			origin += fmt.Sprintf(" (%s)", location)
+		}
+	}
+	return origin
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(v int, others ...int) int {
+	for _, o := range others {
+		if o < v {
+			v = o
+		}
+	}
+	return v
+}
@@ -0,0 +1,305 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 结构体切片的最大长度, 防止通过下标创建过多的元素
+const maxStructSliceLen = 1024
+
+var ErrStructSliceIndex = errors.New("struct slice index err")
+
+// StructSlice 元素为结构体的切片, 每个元素的字段注册为独立的参数, 例如 t_upstreams_0_port
+// 元素保存在独立的内存中, 通过 flush 写回切片字段
+type StructSlice struct {
+	rValue *reflect.Value
+	DefValue
+	Description
+	Has
+	Secret
+	Origin
+	Constraint
+	x     *X
+	tree  *argTree
+	path  []string
+	elems []reflect.Value
+}
+
+func newStructSlice(x *X, r *reflect.Value, tree *argTree, path []string) *StructSlice {
+	ret := &StructSlice{
+		rValue: r,
+		x:      x,
+		tree:   tree,
+		path:   path,
+	}
+	tree.slice = ret
+	return ret
+}
+
+func (s *StructSlice) key() string {
+	return strings.Join(s.path, "_")
+}
+
+func (s *StructSlice) Len() int {
+	return len(s.elems)
+}
+
+// GetValue 返回元素组成的新切片, 不修改切片字段, 可以在读锁中并发调用
+func (s *StructSlice) GetValue() interface{} {
+	return s.value().Interface()
+}
+
+// SetValue 使用 []interface{} 替换所有元素, 每个元素为 map, 也支持相同类型的切片
+func (s *StructSlice) SetValue(v interface{}) error {
+	defer s.flush()
+	var items []interface{}
+	switch vv := v.(type) {
+	case []interface{}:
+		items = vv
+	default:
+		rv := reflect.ValueOf(v)
+		if rv.Type() != s.rValue.Type() {
+			return ErrInvalidValue
+		}
+		s.truncate(0)
+		err := s.grow(rv.Len())
+		if err != nil {
+			return err
+		}
+		for i := 0; i < rv.Len(); i++ {
+			s.elems[i].Elem().Set(rv.Index(i))
+		}
+		return nil
+	}
+	s.truncate(0)
+	err := s.grow(len(items))
+	if err != nil {
+		return err
+	}
+	var unknown []string
+	for i, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return errors.Join(ErrInvalidValue, errors.New(fmt.Sprintf("%s[%d] is not a map", s.key(), i)))
+		}
+		var setErr error
+		flattenMap(m, s.key()+"_"+strconv.Itoa(i)+"_", func(key string, value interface{}) {
+			if setErr != nil {
+				return
+			}
+			arg, has := s.x.lookupArg(key)
+			if !has {
+				unknown = append(unknown, key)
+				return
+			}
+			setErr = arg.SetValue(value)
+			arg.Set()
+		})
+		if setErr != nil {
+			return setErr
+		}
+	}
+	return s.reportUnknown(unknown)
+}
+
+// reportUnknown 元素中未注册的字段, 严格模式下返回错误, 警告模式下与配置源中的未知参数一起报告
+func (s *StructSlice) reportUnknown(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+	if s.x.strict == StrictError {
+		return errors.Join(ErrUnknownKey, errors.New(fmt.Sprintf("key:%s", strings.Join(keys, ","))))
+	}
+	for _, key := range keys {
+		// 通过 Set 设置时没有配置源
+		if s.x.parsing == nil {
+			s.x.addUnknownKey(unknownKey{key: key, source: OriginSet})
+			continue
+		}
+		s.x.addUnknown(s.x.parsing, key)
+	}
+	return nil
+}
+
+// grow 将元素数量增加到 n, 新元素的字段使用标签中的默认值, 由调用方通过 flush 写回字段
+func (s *StructSlice) grow(n int) error {
+	if n > maxStructSliceLen {
+		return errors.Join(ErrStructSliceIndex, errors.New(fmt.Sprintf("%s length %d exceeds %d", s.key(), n, maxStructSliceLen)))
+	}
+	for i := len(s.elems); i < n; i++ {
+		elem := reflect.New(s.rValue.Type().Elem())
+		index := strconv.Itoa(i)
+		tree := newArgTree(index, "")
+		s.x.parseTag(tree, elem.Elem(), append(append([]string{}, s.path...), index)...)
+		s.tree.AppendChild(tree)
+		s.elems = append(s.elems, elem)
+	}
+	return nil
+}
+
+// truncate 删除下标 n 之后的元素以及元素的参数, 由调用方通过 flush 写回字段
+func (s *StructSlice) truncate(n int) {
+	if n >= len(s.elems) {
+		return
+	}
+	for _, tree := range s.tree.child[n:] {
+		prefix := s.key() + "_" + tree.key
+		s.x.rangeArgTree(tree, s.path, func(path []string, arg Arg) {
+			s.x.kv.Delete(strings.Join(path, "_"))
+		})
+		// 删除元素中嵌套的结构体切片
+		var slices []*StructSlice
+		for _, slice := range s.x.slices {
+			if !strings.HasPrefix(slice.key(), prefix+"_") {
+				slices = append(slices, slice)
+			} else {
+				s.x.kv.Delete(slice.key())
+			}
+		}
+		s.x.slices = slices
+	}
+	s.tree.child = s.tree.child[:n]
+	s.elems = s.elems[:n]
+}
+
+// flush 将元素写回切片字段
+func (s *StructSlice) flush() {
+	s.rValue.Set(s.value())
+}
+
+func (s *StructSlice) value() reflect.Value {
+	ret := reflect.MakeSlice(s.rValue.Type(), len(s.elems), len(s.elems))
+	for i, elem := range s.elems {
+		ret.Index(i).Set(elem.Elem())
+	}
+	return ret
+}
+
+// scratch 返回一个没有元素的副本, 元素的参数注册在独立的实例中, 用于在修改之前校验值
+func (s *StructSlice) scratch(strict StrictMode) *StructSlice {
+	tmp := New(WithResultHandler(s.x.handler), WithStrict(strict))
+	v := reflect.New(s.rValue.Type()).Elem()
+	ret := newStructSlice(tmp, &v, newArgTree(s.tree.key, ""), s.path)
+	copyArgMeta(ret, s)
+	return ret
+}
+
+// example 返回一个只包含示例元素的实例, 用于生成配置模板
+func (s *StructSlice) example() (*X, *argTree) {
+	tmp := New(WithResultHandler(s.x.handler))
+	tree := newArgTree("", "")
+	tmp.parseTag(tree, reflect.New(s.rValue.Type().Elem()).Elem())
+	return tmp, tree
+}
+
+// lookupArg 获取参数, 参数不存在时尝试通过下标创建结构体切片的元素, 例如 t_upstreams_0_port
+// 配置源中的参数没有顺序, 下标可以超过当前的长度, 解析结束后通过 checkSliceGaps 报告没有设置任何字段的元素
+func (x *X) lookupArg(key string) (Arg, bool) {
+	arg, has := x.kv.Get(key)
+	if has {
+		return arg, true
+	}
+	for _, slice := range x.slices {
+		i, ok := slice.index(key)
+		if !ok {
+			continue
+		}
+		n := slice.Len()
+		if i >= n {
+			err := slice.grow(i + 1)
+			if err != nil {
+				continue
+			}
+		}
+		arg, has = x.kv.Get(key)
+		if has {
+			return arg, true
+		}
+		// 元素中没有该字段, 删除新增的元素
+		slice.truncate(n)
+	}
+	return nil, false
+}
+
+// index 返回 key 对应的元素下标, 例如 t_upstreams_0_port 返回 0
+func (s *StructSlice) index(key string) (int, bool) {
+	prefix := s.key() + "_"
+	if !strings.HasPrefix(key, prefix) {
+		return 0, false
+	}
+	index, _, _ := strings.Cut(key[len(prefix):], "_")
+	i, err := strconv.Atoi(index)
+	if err != nil || i < 0 || i >= maxStructSliceLen || strconv.Itoa(i) != index {
+		return 0, false
+	}
+	return i, true
+}
+
+// checkSliceGaps 报告配置源中没有设置任何字段的元素, 例如只设置了 t_upstreams_5_host 时 0 到 4 的元素
+func (x *X) checkSliceGaps() {
+	var gaps []string
+	for _, slice := range x.slices {
+		// 整体设置的切片
+		if slice.HasSet() {
+			continue
+		}
+		for _, tree := range slice.tree.child {
+			set := false
+			x.rangeArgTree(tree, slice.path, func(path []string, arg Arg) {
+				set = set || arg.HasSet()
+			})
+			if !set {
+				gaps = append(gaps, slice.key()+"_"+tree.key)
+			}
+		}
+	}
+	if len(gaps) > 0 {
+		x.handler(NewParseResultError(ErrStructSliceIndex,
+			errors.New(fmt.Sprintf("elements %s have no values, indexes must be contiguous", strings.Join(gaps, ","))),
+		))
+	}
+}
+
+// flushSlices 将所有结构体切片的元素写回字段
+func (x *X) flushSlices() {
+	for _, slice := range x.slices {
+		slice.flush()
+	}
+}
+
+// flattenMap 将嵌套的 map 展开为使用 _ 连接的键, 元素为 map 的切片使用下标展开
+func flattenMap(data map[string]interface{}, prefix string, f func(key string, value interface{})) {
+	for key, v := range data {
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			flattenMap(vv, prefix+key+"_", f)
+			continue
+		case []interface{}:
+			if isMapSlice(vv) {
+				for i, item := range vv {
+					flattenMap(item.(map[string]interface{}), prefix+key+"_"+strconv.Itoa(i)+"_", f)
+				}
+				continue
+			}
+		}
+		f(prefix+key, v)
+	}
+}
+
+func isMapSlice(items []interface{}) bool {
+	if len(items) == 0 {
+		return false
+	}
+	for _, item := range items {
+		if _, ok := item.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package conf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/innsanes/conf/internal/yamlnode"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrYamlSync = errors.New("yaml sync err")
+
+type SyncResult struct {
+	// 新增的参数, 使用 yaml 路径表示, 例如 t.struct.name
+	Added []string
+	// 文件中存在但没有注册的参数
+	Unknown []string
+}
+
+// Sync 将文件中缺少的参数按默认值和注释补充到文件中, 保留文件中已有的值, 注释和顺序
+// 需要在 Parse 之后调用
+func (y *Yaml) Sync() (*SyncResult, error) {
+	return y.sync(false, nil)
+}
+
+// SyncDryRun 只将 Sync 会做出的修改写入 w, 不修改文件
+func (y *Yaml) SyncDryRun(w io.Writer) (*SyncResult, error) {
+	return y.sync(true, w)
+}
+
+func (y *Yaml) sync(dryRun bool, w io.Writer) (*SyncResult, error) {
+	paths := splitList(y.YamlConf.FilePath)
+	if len(paths) != 1 || hasGlobMeta(paths[0]) {
+		return nil, errors.Join(ErrYamlSync, errors.New(fmt.Sprintf("sync needs a single file, got %s", y.YamlConf.FilePath)))
+	}
+	file := paths[0]
+	if file == yamlStdin || y.readerOnly || y.fsys != nil {
+		return nil, errors.Join(ErrYamlSync, errors.New("sync needs a local file, not stdin, reader or fs.FS"))
+	}
+	skeleton, err := y.skeleton()
+	if err != nil {
+		return nil, errors.Join(ErrYamlSync, err)
+	}
+
+	// 读取已有文件, 文件不存在或为空时从空配置开始
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}
+	if y.conf.fileExist(file) {
+		binaryData, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Join(ErrYamlSync, err)
+		}
+		var node yaml.Node
+		err = yaml.Unmarshal(binaryData, &node)
+		if err != nil {
+			return nil, errors.Join(ErrYamlSync, errors.New(fmt.Sprintf("%s: %s", file, err)))
+		}
+		if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+			if node.Content[0].Kind != yaml.MappingNode {
+				return nil, errors.Join(ErrYamlSync, errors.New(fmt.Sprintf("%s: root is not a mapping", file)))
+			}
+			doc = &node
+			root = node.Content[0]
+		}
+	}
+
+	result := &SyncResult{}
+	syncNode(root, skeleton, []string{}, result)
+
+	if dryRun {
+		for _, added := range result.Added {
+			_, _ = fmt.Fprintf(w, "+ %s\n", added)
+		}
+		for _, unknown := range result.Unknown {
+			_, _ = fmt.Fprintf(w, "? %s (unknown key)\n", unknown)
+		}
+		return result, nil
+	}
+	if len(result.Added) == 0 {
+		return result, nil
+	}
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	err = encoder.Encode(doc)
+	if err != nil {
+		return nil, errors.Join(ErrYamlSync, err)
+	}
+	y.conf.writeFile(file, buf.Bytes(), y.fileMode)
+	return result, nil
+}
+
+// syncNode 将 src 中 dst 缺少的键补充到 dst 中, 并记录 dst 中多余的键
+func syncNode(dst *yaml.Node, src *yaml.Node, path []string, result *SyncResult) {
+	known := make(map[string]bool)
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		known[key.Value] = true
+		keyPath := append(append([]string{}, path...), key.Value)
+		index := yamlnode.Index(dst, key.Value)
+		if index < 0 {
+			dst.Content = append(dst.Content, key, value)
+			leafPaths(value, keyPath, func(leaf []string, node *yaml.Node) {
+				result.Added = append(result.Added, fmt.Sprintf("%s: %s", strings.Join(leaf, "."), node.Value))
+			})
+			continue
+		}
+		dstValue := dst.Content[index+1]
+		if value.Kind == yaml.MappingNode && dstValue.Kind == yaml.MappingNode {
+			syncNode(dstValue, value, keyPath, result)
+		}
+	}
+	for i := 0; i+1 < len(dst.Content); i += 2 {
+		key := dst.Content[i].Value
+		if known[key] {
+			continue
+		}
+		// 顶层的 include 和 profiles 是保留的键
+		if len(path) == 0 && (key == yamlIncludeKey || key == yamlProfilesKey) {
+			continue
+		}
+		result.Unknown = append(result.Unknown, strings.Join(append(append([]string{}, path...), key), "."))
+	}
+}
+
+func leafPaths(node *yaml.Node, path []string, f func(path []string, node *yaml.Node)) {
+	if node.Kind != yaml.MappingNode {
+		f(path, node)
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		leafPaths(node.Content[i+1], append(append([]string{}, path...), node.Content[i].Value), f)
+	}
+}
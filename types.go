@@ -0,0 +1,241 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ByteSize 字节大小, 支持 512MiB, 1.5GB, 1024 等格式
+type ByteSize uint64
+
+const (
+	Byte ByteSize = 1
+	KB            = 1000 * Byte
+	MB            = 1000 * KB
+	GB            = 1000 * MB
+	TB            = 1000 * GB
+	PB            = 1000 * TB
+	KiB           = 1024 * Byte
+	MiB           = 1024 * KiB
+	GiB           = 1024 * MiB
+	TiB           = 1024 * GiB
+	PiB           = 1024 * TiB
+)
+
+var byteSizeUnits = map[string]ByteSize{
+	"":    Byte,
+	"b":   Byte,
+	"k":   KB,
+	"kb":  KB,
+	"m":   MB,
+	"mb":  MB,
+	"g":   GB,
+	"gb":  GB,
+	"t":   TB,
+	"tb":  TB,
+	"p":   PB,
+	"pb":  PB,
+	"ki":  KiB,
+	"kib": KiB,
+	"mi":  MiB,
+	"mib": MiB,
+	"gi":  GiB,
+	"gib": GiB,
+	"ti":  TiB,
+	"tib": TiB,
+	"pi":  PiB,
+	"pib": PiB,
+}
+
+// 输出时按从大到小的顺序选择能整除的单位
+var byteSizeFormats = []struct {
+	unit ByteSize
+	name string
+}{
+	{PiB, "PiB"}, {PB, "PB"}, {TiB, "TiB"}, {TB, "TB"}, {GiB, "GiB"}, {GB, "GB"},
+	{MiB, "MiB"}, {MB, "MB"}, {KiB, "KiB"}, {KB, "KB"},
+}
+
+// ParseByteSize 解析字节大小, 单位不区分大小写, 没有单位时为字节
+func ParseByteSize(str string) (ByteSize, error) {
+	s := strings.TrimSpace(str)
+	index := strings.IndexFunc(s, func(r rune) bool {
+		return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+	})
+	number, unit := s, ""
+	if index >= 0 {
+		number, unit = strings.TrimSpace(s[:index]), s[index:]
+	}
+	multiple, ok := byteSizeUnits[strings.ToLower(unit)]
+	if !ok || number == "" {
+		return 0, errors.Join(ErrInvalidValue, errors.New(fmt.Sprintf("%q is not a valid byte size", str)))
+	}
+	// 整数直接计算, 避免浮点数精度问题
+	if n, err := strconv.ParseUint(number, 10, 64); err == nil {
+		if n > math.MaxUint64/uint64(multiple) {
+			return 0, errors.Join(ErrValueOutOfRange, errors.New(fmt.Sprintf("%q overflows byte size", str)))
+		}
+		return ByteSize(n) * multiple, nil
+	}
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil || f < 0 {
+		return 0, errors.Join(ErrInvalidValue, errors.New(fmt.Sprintf("%q is not a valid byte size", str)))
+	}
+	f = f * float64(multiple)
+	if f >= math.MaxUint64 {
+		return 0, errors.Join(ErrValueOutOfRange, errors.New(fmt.Sprintf("%q overflows byte size", str)))
+	}
+	if f != math.Trunc(f) {
+		return 0, errors.Join(ErrInvalidValue, errors.New(fmt.Sprintf("%q is not a whole number of bytes", str)))
+	}
+	return ByteSize(f), nil
+}
+
+func (b ByteSize) String() string {
+	if b == 0 {
+		return "0B"
+	}
+	for _, format := range byteSizeFormats {
+		if b%format.unit == 0 {
+			return fmt.Sprintf("%d%s", b/format.unit, format.name)
+		}
+	}
+	return fmt.Sprintf("%dB", uint64(b))
+}
+
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	v, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+// Percent 百分比, 保存为比例, 例如 75% 保存为 0.75
+type Percent float64
+
+// ParsePercent 解析百分比, 带 % 时除以 100, 不带 % 时作为比例
+func ParsePercent(str string) (Percent, error) {
+	s := strings.TrimSpace(str)
+	divisor := 1.0
+	if strings.HasSuffix(s, "%") {
+		s = strings.TrimSpace(strings.TrimSuffix(s, "%"))
+		divisor = 100
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.Join(ErrInvalidValue, errors.New(fmt.Sprintf("%q is not a valid percent", str)))
+	}
+	return Percent(f / divisor), nil
+}
+
+func (p Percent) String() string {
+	// 保留10位小数, 去掉浮点数运算的误差
+	v := math.Round(float64(p)*100*1e10) / 1e10
+	return strconv.FormatFloat(v, 'f', -1, 64) + "%"
+}
+
+func (p Percent) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Percent) UnmarshalText(text []byte) error {
+	v, err := ParsePercent(string(text))
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+var (
+	byteSizeType = reflect.TypeOf(ByteSize(0))
+	percentType  = reflect.TypeOf(Percent(0))
+)
+
+type ByteSizeArg struct {
+	rValue *reflect.Value
+	DefValue
+	Description
+	Has
+	Secret
+	Origin
+	Constraint
+}
+
+func NewByteSizeArg(r *reflect.Value) *ByteSizeArg {
+	ret := &ByteSizeArg{rValue: r}
+	return ret
+}
+
+func (b *ByteSizeArg) GetValue() interface{} {
+	return ByteSize(b.rValue.Uint())
+}
+
+func (b *ByteSizeArg) SetValue(str interface{}) error {
+	switch v := str.(type) {
+	case ByteSize:
+		b.rValue.SetUint(uint64(v))
+	case string:
+		vv, err := ParseByteSize(v)
+		if err != nil {
+			return err
+		}
+		b.rValue.SetUint(uint64(vv))
+	default:
+		vv, err := toUint64(v)
+		if err != nil {
+			return err
+		}
+		b.rValue.SetUint(vv)
+	}
+	return nil
+}
+
+type PercentArg struct {
+	rValue *reflect.Value
+	DefValue
+	Description
+	Has
+	Secret
+	Origin
+	Constraint
+}
+
+func NewPercentArg(r *reflect.Value) *PercentArg {
+	ret := &PercentArg{rValue: r}
+	return ret
+}
+
+func (p *PercentArg) GetValue() interface{} {
+	return Percent(p.rValue.Float())
+}
+
+func (p *PercentArg) SetValue(str interface{}) error {
+	switch v := str.(type) {
+	case Percent:
+		p.rValue.SetFloat(float64(v))
+	case string:
+		vv, err := ParsePercent(v)
+		if err != nil {
+			return err
+		}
+		p.rValue.SetFloat(float64(vv))
+	default:
+		vv, err := toFloat64(v)
+		if err != nil {
+			return err
+		}
+		p.rValue.SetFloat(vv)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var ErrUnmarshal = errors.New("unmarshal err")
+
+// UnmarshalKey 将 key 下的所有参数解析到 v 中, v 可以是 Parse 时没有注册的结构体
+// 值的优先级与 Parse 一致, 已注册参数的值优先, 其次按照配置源注册的顺序, 最后使用标签中的默认值
+// 解析完成后按照标签中的规则校验
+// 需要在 Parse 之后调用
+func (x *X) UnmarshalKey(key string, v interface{}) error {
+	if v == nil || reflect.TypeOf(v).Kind() != reflect.Ptr || reflect.TypeOf(v).Elem().Kind() != reflect.Struct {
+		return errors.Join(ErrUnmarshal, ErrRegisterConfigNotPtr)
+	}
+	// 与 Reload 互斥, Reload 会修改参数以及配置源中的值
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var errs []error
+	tmp := New(WithResultHandler(func(result *ParseResult) {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}))
+	tmp.parseStruct(&service{Name: key, Conf: v})
+
+	set := func(k string, value interface{}) {
+		arg, has := tmp.lookupArg(k)
+		if !has || arg.HasSet() {
+			return
+		}
+		err := arg.SetValue(value)
+		if err != nil {
+			errs = append(errs, errors.Join(ErrArgSetValue, errors.New(fmt.Sprintf("arg %s SetValue %v", k, value)), err))
+			return
+		}
+		arg.Set()
+	}
+	// 已经注册并被设置过的参数
+	x.kv.Range(func(k string, arg Arg) bool {
+		if hasKeyPrefix(k, key) && arg.HasSet() {
+			set(k, arg.GetValue())
+		}
+		return true
+	})
+	// 配置源中的参数
+	for _, source := range x.sources {
+		source.Range(func(k string, value interface{}) bool {
+			if hasKeyPrefix(k, key) {
+				set(k, value)
+			}
+			return true
+		})
+	}
+	tmp.flushSlices()
+	err := tmp.validate()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return errors.Join(append([]error{ErrUnmarshal}, errs...)...)
+	}
+	return nil
+}
+
+// hasKeyPrefix 判断 key 是否为 prefix 或者在 prefix 之下
+func hasKeyPrefix(key string, prefix string) bool {
+	return key == prefix || strings.HasPrefix(key, prefix+"_")
+}
+
+// Sub 表示 key 前缀下的配置
+type Sub struct {
+	x      *X
+	prefix string
+}
+
+func (x *X) Sub(prefix string) *Sub {
+	return &Sub{
+		x:      x,
+		prefix: prefix,
+	}
+}
+
+// Sub 返回下一级前缀的配置
+func (s *Sub) Sub(prefix string) *Sub {
+	return s.x.Sub(s.prefix + "_" + prefix)
+}
+
+func (s *Sub) Unmarshal(v interface{}) error {
+	return s.x.UnmarshalKey(s.prefix, v)
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -38,9 +40,9 @@ func (x *X) fileExist(filepath string) bool {
 	return true
 }
 
-func (x *X) writeFile(filepath string, content []byte) {
+func (x *X) writeFile(filepath string, content []byte, perm os.FileMode) {
 	// 打开文件
-	file, err := os.OpenFile(filepath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0777)
+	file, err := os.OpenFile(filepath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, perm)
 	if err != nil {
 		x.handler(NewParseResultError(ErrOpenFile, err))
 	}
@@ -54,6 +56,56 @@ func (x *X) writeFile(filepath string, content []byte) {
 	}
 }
 
+// splitList 按逗号分隔字符串, 去除空白和空项
+func splitList(str string) []string {
+	var ret []string
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		ret = append(ret, item)
+	}
+	return ret
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// expandFiles 展开 glob 匹配的文件, 保持顺序并去重
+// glob 没有匹配到文件时忽略, 普通路径原样保留
+func expandFiles(paths []string, glob func(pattern string) ([]string, error)) ([]string, error) {
+	var ret []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		matches := []string{path}
+		if hasGlobMeta(path) {
+			var err error
+			matches, err = glob(path)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("glob %s: %s", path, err))
+			}
+		}
+		for _, match := range matches {
+			if seen[match] {
+				continue
+			}
+			seen[match] = true
+			ret = append(ret, match)
+		}
+	}
+	return ret, nil
+}
+
+// relativePath 将相对路径转换为相对于 dir 的路径
+func relativePath(dir string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
 func snakeCase(str string) string {
 	var (
 		ret []rune
@@ -67,6 +119,31 @@ func snakeCase(str string) string {
 	return strings.ToLower(string(ret))
 }
 
-func (x *X) panic(format string, v ...interface{}) {
-	panic(fmt.Sprintf(format, v...))
+// envName 参数对应的环境变量名称, 例如 t_struct_name -> T_STRUCT_NAME
+func envName(key string) string {
+	return strings.ToUpper(key)
+}
+
+func isSafeChar(r rune, extra string) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune(extra, r)
+}
+
+// envQuote 环境变量的值包含特殊字符时加上双引号
+func envQuote(value string) string {
+	for _, r := range value {
+		if !isSafeChar(r, "_-.,:/@%+") {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
+
+// shellQuote 命令行参数包含特殊字符时加上单引号
+func shellQuote(arg string) string {
+	for _, r := range arg {
+		if !isSafeChar(r, "_-.,:/@%+=") {
+			return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return arg
 }
@@ -0,0 +1,116 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+var ErrValidate = errors.New("validate err")
+
+// Validate 按照标签中的规则校验所有参数, 返回所有不满足规则的参数
+func (x *X) Validate() error {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.validate()
+}
+
+func (x *X) validate() error {
+	var keys []string
+	x.kv.Range(func(key string, _ Arg) bool {
+		keys = append(keys, key)
+		return true
+	})
+	sort.Strings(keys)
+	var errs []error
+	for _, key := range keys {
+		arg, _ := x.kv.Get(key)
+		err := validateArg(key, arg)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(append([]error{ErrValidate}, errs...)...)
+	}
+	return nil
+}
+
+func validateArg(key string, arg Arg) error {
+	rule := argRule(arg)
+	if !arg.HasSet() && arg.GetDefaultValue() == "" {
+		if rule.Required {
+			return errors.New(fmt.Sprintf("%s is required", key))
+		}
+		// 没有设置也没有默认值的可选参数不校验 enum, min, max
+		return nil
+	}
+	return validateValue(key, arg)
+}
+
+// validateValue 校验参数当前的值是否满足 enum, min, max 规则
+func validateValue(key string, arg Arg) error {
+	rule := argRule(arg)
+	value := arg.GetValue()
+	if len(rule.Enum) > 0 {
+		for _, item := range valueItems(value) {
+			if !inEnum(fmt.Sprint(item), rule.Enum) {
+				return errors.New(fmt.Sprintf("%s value %v not in %v", key, item, rule.Enum))
+			}
+		}
+	}
+	if rule.Min == nil && rule.Max == nil {
+		return nil
+	}
+	size, unit, ok := valueSize(value)
+	if !ok {
+		return nil
+	}
+	if rule.Min != nil && size < *rule.Min {
+		return errors.New(fmt.Sprintf("%s %s %v less than min %v", key, unit, size, *rule.Min))
+	}
+	if rule.Max != nil && size > *rule.Max {
+		return errors.New(fmt.Sprintf("%s %s %v greater than max %v", key, unit, size, *rule.Max))
+	}
+	return nil
+}
+
+// valueItems 切片返回所有元素, 其他值返回自身
+func valueItems(value interface{}) []interface{} {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice {
+		return []interface{}{value}
+	}
+	var items []interface{}
+	for i := 0; i < rv.Len(); i++ {
+		items = append(items, rv.Index(i).Interface())
+	}
+	return items
+}
+
+// valueSize 数值返回大小, 字符串和切片返回长度
+func valueSize(value interface{}) (float64, string, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), "value", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), "value", true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), "value", true
+	case reflect.String, reflect.Slice:
+		return float64(rv.Len()), "length", true
+	default:
+		return 0, "", false
+	}
+}
+
+func inEnum(value string, enum []string) bool {
+	for _, item := range enum {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}